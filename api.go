@@ -0,0 +1,230 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"data-pipeline/nodes"
+)
+
+// apiServer serves the HTTP control API of serve mode:
+//
+//	GET    /pipelines            list pipelines, their nodes and schedules
+//	POST   /pipelines/{name}/runs start a run; the optional body overrides node config:
+//	                             {"overrides": {"ImportHubspotContacts": {"limit": 10}}}
+//	GET    /runs/{id}            status and per-node progress of a run
+//	DELETE /runs/{id}            cancel a run
+//
+// Responses are JSON; errors are {"error": "..."}. If token is set, every
+// request must carry it as "Authorization: Bearer <token>".
+type apiServer struct {
+	cfg   *AppConfig
+	runs  *runRegistry
+	token string
+}
+
+// handler returns the API's routes.
+func (a *apiServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /pipelines", a.listPipelines)
+	mux.HandleFunc("POST /pipelines/{name}/runs", a.startRun)
+	mux.HandleFunc("GET /runs/{id}", a.getRun)
+	mux.HandleFunc("DELETE /runs/{id}", a.cancelRun)
+	if a.token == "" {
+		return mux
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// pipelineInfo describes a pipeline in GET /pipelines.
+type pipelineInfo struct {
+	Name       string     `json:"name"`
+	Schedule   string     `json:"schedule,omitempty"`
+	RunningRun string     `json:"runningRun,omitempty"`
+	Nodes      []nodeInfo `json:"nodes"`
+}
+
+type nodeInfo struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+func (a *apiServer) listPipelines(w http.ResponseWriter, r *http.Request) {
+	names := slices.Sorted(maps.Keys(a.cfg.Pipelines))
+	pipelines := make([]pipelineInfo, 0, len(names))
+	for _, name := range names {
+		pipelineCfg := a.cfg.Pipelines[name]
+		info := pipelineInfo{Name: name, Schedule: pipelineCfg.Schedule.spec(), Nodes: []nodeInfo{}}
+		if run, ok := a.runs.running(name); ok {
+			info.RunningRun = run.ID
+		}
+		for _, n := range pipelineCfg.Nodes {
+			info.Nodes = append(info.Nodes, nodeInfo{Name: n.Name, Type: n.Type})
+		}
+		pipelines = append(pipelines, info)
+	}
+	writeJSON(w, http.StatusOK, pipelines)
+}
+
+// startRunRequest is the optional body of POST /pipelines/{name}/runs.
+type startRunRequest struct {
+	// Overrides replaces config keys of individual nodes for this run only.
+	Overrides map[string]map[string]interface{} `json:"overrides"`
+}
+
+func (a *apiServer) startRun(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	pipelineCfg, ok := a.cfg.Pipelines[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown pipeline '%s'", name))
+		return
+	}
+	var req startRunRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	pipelineCfg, err := withOverrides(pipelineCfg, req.Overrides)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	run, err := a.runs.start(name, pipelineCfg)
+	if errors.Is(err, errAlreadyRunning) {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	if errors.Is(err, errShuttingDown) {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	log.Printf("[%s] Run %s started through the API.", name, run.ID)
+	w.Header().Set("Location", "/runs/"+run.ID)
+	writeJSON(w, http.StatusAccepted, run.snapshot())
+}
+
+func (a *apiServer) getRun(w http.ResponseWriter, r *http.Request) {
+	run, ok := a.runs.get(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown run '%s'", r.PathValue("id")))
+		return
+	}
+	writeJSON(w, http.StatusOK, run.snapshot())
+}
+
+func (a *apiServer) cancelRun(w http.ResponseWriter, r *http.Request) {
+	run, ok := a.runs.get(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown run '%s'", r.PathValue("id")))
+		return
+	}
+	if status := run.snapshot(); status.Finished != nil {
+		writeError(w, http.StatusConflict, fmt.Errorf("run '%s' has already %s", status.ID, status.Status))
+		return
+	}
+	run.cancel()
+	log.Printf("[%s] Run %s cancelled through the API.", run.Pipeline, run.ID)
+	writeJSON(w, http.StatusAccepted, run.snapshot())
+}
+
+// protectedConfigKeys are node config keys an API request may not override,
+// at any depth: connections, credentials, queries and file locations, which
+// would let a caller read from or write to places config.yaml does not
+// allow, and the settings that turn a run into an endless stream or move
+// consumer offsets.
+var protectedConfigKeys = map[string]bool{
+	"apikey": true, "brokers": true, "cachefilepath": true, "collection": true,
+	"database": true, "databasefile": true, "destinationfile": true, "driver": true,
+	"dsn": true, "endpoint": true, "filter": true, "follow": true, "groupid": true,
+	"listen": true, "mode": true, "path": true, "paths": true, "publicurl": true,
+	"query": true, "schemafile": true, "secret": true, "signature": true,
+	"signatureheader": true, "sourcefile": true, "table": true, "topic": true,
+	"uri": true,
+}
+
+// protectedKey returns the first protected key in an override value,
+// looking into nested objects and lists, such as a join's lookup source.
+func protectedKey(values map[string]interface{}) (string, bool) {
+	for key, value := range values {
+		if protectedConfigKeys[strings.ToLower(key)] {
+			return key, true
+		}
+		if nested, ok := protectedKeyIn(value); ok {
+			return key + "." + nested, true
+		}
+	}
+	return "", false
+}
+
+// protectedKeyIn is protectedKey for a value of any type.
+func protectedKeyIn(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return protectedKey(v)
+	case []interface{}:
+		for i, item := range v {
+			if nested, ok := protectedKeyIn(item); ok {
+				return fmt.Sprintf("%d.%s", i, nested), true
+			}
+		}
+	}
+	return "", false
+}
+
+// withOverrides returns a copy of pipelineCfg in which the config of the
+// named nodes is overridden key by key. Protected keys are rejected.
+func withOverrides(pipelineCfg PipelineConfig, overrides map[string]map[string]interface{}) (PipelineConfig, error) {
+	if len(overrides) == 0 {
+		return pipelineCfg, nil
+	}
+	pipelineCfg.Nodes = slices.Clone(pipelineCfg.Nodes)
+	for nodeName, values := range overrides {
+		i := slices.IndexFunc(pipelineCfg.Nodes, func(n nodes.PipelineNode) bool { return n.Name == nodeName })
+		if i < 0 {
+			return pipelineCfg, fmt.Errorf("override for unknown node '%s'", nodeName)
+		}
+		if key, ok := protectedKey(values); ok {
+			return pipelineCfg, fmt.Errorf("node '%s': '%s' cannot be overridden through the API", nodeName, key)
+		}
+		config := maps.Clone(pipelineCfg.Nodes[i].Config)
+		if config == nil {
+			config = make(map[string]interface{})
+		}
+		maps.Copy(config, values)
+		pipelineCfg.Nodes[i].Config = config
+	}
+	return pipelineCfg, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Warning: failed to write API response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
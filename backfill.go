@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"data-pipeline/helpers"
+	"data-pipeline/nodes"
+)
+
+const backfillUsage = `Usage: data-pipeline backfill --pipeline P --from DATE --to DATE [flags]
+
+Runs a pipeline once per time slice of [--from, --to). In every run the
+sources with a time-based watermark read the records changed in their slice
+instead of those changed since their watermark; no node state is committed,
+so the live watermarks stay where they are.
+
+Completed slices are recorded, so running the same command again after an
+interruption or a failure only runs the missing slices. On SIGINT or SIGTERM
+no new slices are started and the running ones are cancelled.
+
+Flags:
+  --config FILE    configuration file (default config.yaml)
+  --pipeline P     pipeline to backfill
+  --from DATE      start of the range, inclusive (2024-01-01 or RFC 3339)
+  --to DATE        end of the range, exclusive
+  --chunk D        slice length, e.g. 7d or 12h (default 1d)
+  --parallel N     slices to run at once (default 1)
+  --restart        forget recorded progress and run every slice
+`
+
+// backfillDir holds the progress of backfills when no shared state store, or
+// a JSON state file, is configured.
+var backfillDir = "./cache/backfill"
+
+// backfillOptions are the parsed flags of a backfill.
+type backfillOptions struct {
+	pipeline string
+	from, to time.Time
+	chunk    time.Duration
+	parallel int
+	restart  bool
+}
+
+// backfillSlice is the time window of one backfill run.
+type backfillSlice nodes.TimeWindow
+
+// key identifies the slice in the backfill progress.
+func (s backfillSlice) key() string {
+	return s.From.Format(time.RFC3339) + "/" + s.To.Format(time.RFC3339)
+}
+
+// backfillCommand runs `data-pipeline backfill ...` and returns the exit code.
+func backfillCommand(args []string) int {
+	fs := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(fs.Output(), backfillUsage) }
+	configFile := fs.String("config", "config.yaml", "Path to the configuration file")
+	var opts backfillOptions
+	var from, to, chunk string
+	fs.StringVar(&opts.pipeline, "pipeline", "", "Pipeline to backfill")
+	fs.StringVar(&from, "from", "", "Start of the range")
+	fs.StringVar(&to, "to", "", "End of the range")
+	fs.StringVar(&chunk, "chunk", "1d", "Slice length")
+	fs.IntVar(&opts.parallel, "parallel", 1, "Slices to run at once")
+	fs.BoolVar(&opts.restart, "restart", false, "Forget recorded progress")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	var err error
+	if opts.from, err = parseDateFlag("from", from); err != nil {
+		return backfillFailed(err)
+	}
+	if opts.to, err = parseDateFlag("to", to); err != nil {
+		return backfillFailed(err)
+	}
+	if opts.chunk, err = parseChunk(chunk); err != nil {
+		return backfillFailed(err)
+	}
+	ctx, stop := interruptContext()
+	defer stop()
+	cfg, err := loadConfig(*configFile)
+	if err == nil {
+		err = applySettings(cfg)
+	}
+	if err == nil {
+		err = runBackfill(ctx, cfg, opts)
+	}
+	if closeErr := releaseSettings(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		code := backfillFailed(err)
+		if ctx.Err() != nil {
+			code = exitInterrupted
+		}
+		return code
+	}
+	return 0
+}
+
+func backfillFailed(err error) int {
+	fmt.Fprintf(os.Stderr, "backfill: %v\n", err)
+	return 1
+}
+
+// runBackfill runs the slices of a backfill that have not completed yet,
+// opts.parallel at a time. Failed slices are reported but do not stop the
+// others.
+func runBackfill(ctx context.Context, cfg *AppConfig, opts backfillOptions) error {
+	pipelineCfg, ok := cfg.Pipelines[opts.pipeline]
+	if !ok {
+		return fmt.Errorf("unknown pipeline '%s'", opts.pipeline)
+	}
+	if !opts.from.Before(opts.to) {
+		return errors.New("--from must be before --to")
+	}
+	if opts.chunk <= 0 {
+		return errors.New("--chunk must be positive")
+	}
+	parallel := max(opts.parallel, 1)
+
+	// Backfills of a pipeline must not overlap; live runs may continue, since
+	// slices only read a snapshot of the live state (see snapshotState).
+	lock, err := helpers.AcquireFileLock(lockFile(opts.pipeline+".backfill"), pipelineLocks.Wait)
+	if errors.Is(err, helpers.ErrLocked) {
+		return fmt.Errorf("a backfill of pipeline '%s' is already running: %w", opts.pipeline, err)
+	}
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	progress, err := backfillProgress(opts.pipeline)
+	if err != nil {
+		return fmt.Errorf("failed to open backfill progress: %w", err)
+	}
+	if closer, ok := progress.(io.Closer); ok {
+		defer closer.Close()
+	}
+	all := splitRange(opts.from, opts.to, opts.chunk)
+	var pending []backfillSlice
+	for _, slice := range all {
+		if opts.restart {
+			if err := progress.Delete(slice.key()); err != nil {
+				return err
+			}
+		} else if _, done, err := progress.Get(slice.key()); err != nil {
+			return err
+		} else if done {
+			continue
+		}
+		pending = append(pending, slice)
+	}
+	log.Printf("[%s] Backfill of %d slice(s): %d already done, running %d with parallelism %d.",
+		opts.pipeline, len(all), len(all)-len(pending), len(pending), parallel)
+
+	jobs := make(chan backfillSlice)
+	var mu sync.Mutex
+	var failed []string
+	var wg sync.WaitGroup
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for slice := range jobs {
+				window := nodes.TimeWindow(slice)
+				log.Printf("[%s] Backfilling %s.", opts.pipeline, slice.key())
+				err := runPipeline(ctx, opts.pipeline, pipelineCfg, runOptions{window: &window})
+				if err == nil {
+					err = progress.Set(slice.key(), time.Now().UTC().Format(time.RFC3339))
+				}
+				if err != nil {
+					log.Printf("[%s] ERROR: backfill of %s failed: %v", opts.pipeline, slice.key(), err)
+					mu.Lock()
+					failed = append(failed, slice.key())
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, slice := range pending {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- slice
+	}
+	close(jobs)
+	wg.Wait()
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d slice(s) failed (%s); run the same command again to retry them",
+			len(failed), len(pending), strings.Join(failed, ", "))
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	log.Printf("[%s] Backfill complete.", opts.pipeline)
+	return nil
+}
+
+// splitRange splits [from, to) into slices of length chunk; the last one
+// ends at to.
+func splitRange(from, to time.Time, chunk time.Duration) []backfillSlice {
+	var out []backfillSlice
+	for start := from; start.Before(to); start = start.Add(chunk) {
+		end := start.Add(chunk)
+		if end.After(to) {
+			end = to
+		}
+		out = append(out, backfillSlice{From: start, To: end})
+	}
+	return out
+}
+
+// backfillProgress returns where completed slices of a pipeline's backfills
+// are recorded: the shared state store, or a JSON file under backfillDir. A
+// shared JSON state file is not used, since live runs lock it while they run.
+func backfillProgress(pipelineName string) (helpers.StateStore, error) {
+	if _, isFile := stateStore.(*helpers.SharedFileStateStore); stateStore != nil && !isFile {
+		return helpers.NamespacedStateStore(stateStore, pipelineName+"/_backfill/"), nil
+	}
+	return helpers.NewFileStateStore(filepath.Join(backfillDir, pipelineName+".json"))
+}
+
+// parseChunk parses a slice length: a Go duration, or a number of days
+// such as "7d".
+func parseChunk(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid --chunk %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid --chunk %q (want e.g. 7d or 12h)", s)
+	}
+	return d, nil
+}
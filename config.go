@@ -0,0 +1,270 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"data-pipeline/helpers"
+	"data-pipeline/nodes"
+	"github.com/robfig/cron/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// PipelineConfig is the configuration of a single pipeline. In config.yaml a
+// pipeline is either a plain list of nodes, or a mapping with a `nodes` list
+// plus pipeline-level settings:
+//
+//	pipelines:
+//	  simple_flow:
+//	    - name: "ImportContacts"
+//	      ...
+//	  main_contact_flow:
+//	    schemaDrift:
+//	      enabled: true
+//	    commitAfter: "PersistContacts" // optional, see CommitAfter
+//	    nodes:
+//	      - name: "ImportHubspotContacts"
+//	        ...
+type PipelineConfig struct {
+	Nodes       []nodes.PipelineNode `yaml:"nodes"`
+	SchemaDrift SchemaDriftConfig    `yaml:"schemaDrift"`
+	// CommitAfter names the node after which the state changes nodes made in
+	// a run (watermarks, offsets, seen keys) are committed. By default they
+	// are committed once the last node has succeeded; a failed run discards
+	// them, so its records are read again by the next run. Naming the node
+	// that persists the records keeps failures in later nodes (e.g.
+	// notifications) from replaying them.
+	CommitAfter string `yaml:"commitAfter"`
+	// Schedule runs the pipeline periodically in `data-pipeline serve`.
+	Schedule ScheduleConfig `yaml:"schedule"`
+
+	validated bool // defaults filled in and settings checked by validate
+}
+
+// ScheduleConfig triggers a pipeline on a cron schedule while the process
+// runs in serve mode:
+//
+//	pipelines:
+//	  main_contact_flow:
+//	    schedule:
+//	      cron: "*/15 * * * *"      // minute hour day month weekday, or @hourly, @every 10m
+//	      timezone: "Europe/Berlin" // default: the local time zone
+//	      overlap: "queue"          // skip (default) or queue
+//	    nodes:
+//	      ...
+//
+// `schedule: "*/15 * * * *"` is short for a schedule with only a cron
+// expression. A trigger that fires while the previous run is still going is
+// dropped with overlap "skip"; with "queue" one more run starts as soon as
+// the current one ends.
+type ScheduleConfig struct {
+	Cron     string `yaml:"cron"`
+	Timezone string `yaml:"timezone"`
+	Overlap  string `yaml:"overlap"`
+}
+
+// Overlap policies of a schedule.
+const (
+	overlapSkip  = "skip"
+	overlapQueue = "queue"
+)
+
+// UnmarshalYAML accepts a plain cron expression as well as a mapping.
+func (s *ScheduleConfig) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&s.Cron)
+	}
+	type plain ScheduleConfig // avoid recursing into this method
+	return value.Decode((*plain)(s))
+}
+
+// spec returns the cron expression with its time zone, as understood by
+// the scheduler.
+func (s ScheduleConfig) spec() string {
+	if s.Timezone == "" {
+		return s.Cron
+	}
+	return "CRON_TZ=" + s.Timezone + " " + s.Cron
+}
+
+// validate fills in defaults and checks the expression and time zone.
+func (s *ScheduleConfig) validate() error {
+	if s.Cron == "" {
+		if s.Timezone != "" || s.Overlap != "" {
+			return errors.New("schedule has no cron expression")
+		}
+		return nil
+	}
+	if _, err := cron.ParseStandard(s.spec()); err != nil {
+		return fmt.Errorf("invalid schedule %q: %w", s.spec(), err)
+	}
+	switch s.Overlap {
+	case "":
+		s.Overlap = overlapSkip
+	case overlapSkip, overlapQueue:
+	default:
+		return fmt.Errorf("invalid schedule overlap %q (want skip or queue)", s.Overlap)
+	}
+	return nil
+}
+
+// ShutdownConfig controls how a run stops on SIGINT or SIGTERM:
+//
+//	shutdown:
+//	  grace: "30s" // how long batches already handed to a node may take to finish
+//
+// No new batches are started once the signal arrives. Batches still running
+// after grace see their context cancelled.
+type ShutdownConfig struct {
+	Grace time.Duration `yaml:"grace"` // default 30s
+}
+
+// defaultShutdownGrace is how long running batches may take to finish after
+// a run was stopped, unless configured otherwise.
+const defaultShutdownGrace = 30 * time.Second
+
+// CacheConfig controls how node caches (watermarks, offsets, file positions)
+// are written:
+//
+//	cache:
+//	  writeBehind: "5s" // save each cache at most every 5s instead of on every change
+//
+// Pending changes are always saved when a pipeline run ends. On a crash up to
+// writeBehind of progress is lost and the affected data is read again.
+type CacheConfig struct {
+	WriteBehind time.Duration `yaml:"writeBehind"` // default 0: save on every change
+}
+
+// StateConfig selects a shared store for the state nodes keep between runs
+// (watermarks, file positions, resume tokens, seen keys):
+//
+//	state:
+//	  backend: "sqlite"          // file, sqlite or memory
+//	  path: "./cache/state.db"   // default ./cache/state.json or ./cache/state.db
+//
+// Keys are namespaced as "<pipeline>/<node>/<key>". Without a backend every
+// node keeps its state in its own JSON file (the node's cacheFilePath). When
+// a backend is turned on, a node whose namespace is still empty gets the
+// contents of that file the first time it is used; the file is then renamed
+// to "<cacheFilePath>.imported".
+type StateConfig struct {
+	Backend string `yaml:"backend"`
+	Path    string `yaml:"path"`
+}
+
+// openStateStore opens the configured store, or returns nil if none is
+// configured.
+func (c StateConfig) openStateStore() (helpers.StateStore, error) {
+	path := c.Path
+	switch {
+	case c.Backend == "":
+		return nil, nil
+	case path == "" && c.Backend == helpers.StateBackendFile:
+		path = "./cache/state.json"
+	case path == "" && c.Backend == helpers.StateBackendSQLite:
+		path = "./cache/state.db"
+	}
+	return helpers.OpenStateStore(c.Backend, path)
+}
+
+// LockConfig controls the advisory file locks that keep two processes from
+// running the same pipeline or using the same cache file at once:
+//
+//	locks:
+//	  dir: "./cache/locks" // one <pipeline>.lock file per pipeline
+//	  wait: "5m"           // wait for a running instance instead of failing at once
+//
+// Locks are released by the operating system when a process exits, so a
+// crashed run does not block the next one.
+type LockConfig struct {
+	Dir  string        `yaml:"dir"`  // default "./cache/locks"
+	Wait time.Duration `yaml:"wait"` // default 0: fail with "already running"
+}
+
+// defaultLockDir holds the pipeline lock files unless configured otherwise.
+const defaultLockDir = "./cache/locks"
+
+// SchemaDriftConfig controls schema inference and drift detection for a
+// pipeline. Each policy is one of "ignore", "warn" or "fail".
+type SchemaDriftConfig struct {
+	Enabled        bool     `yaml:"enabled"`
+	StoreDir       string   `yaml:"storeDir"`       // default "./cache/schemas"
+	Nodes          []string `yaml:"nodes"`          // nodes to track; all nodes if empty
+	OnFieldAdded   string   `yaml:"onFieldAdded"`   // default "warn"
+	OnFieldRemoved string   `yaml:"onFieldRemoved"` // default "warn"
+	OnTypeChanged  string   `yaml:"onTypeChanged"`  // default "fail"
+	KeepRuns       int      `yaml:"keepRuns"`       // per-run schema files kept besides latest.json (default 30)
+}
+
+// UnmarshalYAML accepts both the list and the mapping form of a pipeline.
+func (p *PipelineConfig) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.SequenceNode {
+		return value.Decode(&p.Nodes)
+	}
+	type plain PipelineConfig // avoid recursing into this method
+	return value.Decode((*plain)(p))
+}
+
+// validate fills in defaults and checks pipeline-level settings. Configs
+// loaded by loadConfig are validated there; later calls return at once.
+func (p *PipelineConfig) validate() error {
+	if p.validated {
+		return nil
+	}
+	names := make(map[string]bool, len(p.Nodes))
+	for _, n := range p.Nodes {
+		if names[n.Name] {
+			return fmt.Errorf("node name '%s' is used more than once", n.Name)
+		}
+		names[n.Name] = true
+	}
+	if p.CommitAfter != "" && p.commitIndex() < 0 {
+		return fmt.Errorf("commitAfter refers to unknown node '%s'", p.CommitAfter)
+	}
+	if err := p.Schedule.validate(); err != nil {
+		return err
+	}
+	d := &p.SchemaDrift
+	if d.StoreDir == "" {
+		d.StoreDir = "./cache/schemas"
+	}
+	for _, policy := range []*string{&d.OnFieldAdded, &d.OnFieldRemoved, &d.OnTypeChanged} {
+		if *policy == "" {
+			continue
+		}
+		switch *policy {
+		case driftIgnore, driftWarn, driftFail:
+		default:
+			return fmt.Errorf("invalid schema drift policy %q (want ignore, warn or fail)", *policy)
+		}
+	}
+	if d.OnFieldAdded == "" {
+		d.OnFieldAdded = driftWarn
+	}
+	if d.OnFieldRemoved == "" {
+		d.OnFieldRemoved = driftWarn
+	}
+	if d.OnTypeChanged == "" {
+		d.OnTypeChanged = driftFail
+	}
+	if d.KeepRuns < 0 {
+		return fmt.Errorf("invalid schema drift keepRuns %d", d.KeepRuns)
+	}
+	if d.KeepRuns == 0 {
+		d.KeepRuns = 30
+	}
+	p.validated = true
+	return nil
+}
+
+// commitIndex returns the index of the CommitAfter node, or -1 if there is
+// none and state is committed after the last node.
+func (p *PipelineConfig) commitIndex() int {
+	for i, n := range p.Nodes {
+		if p.CommitAfter != "" && n.Name == p.CommitAfter {
+			return i
+		}
+	}
+	return -1
+}
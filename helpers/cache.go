@@ -2,31 +2,180 @@ package helpers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 )
 
 // FileCache implements a simple key-value cache stored in a JSON file.
+//
+// The file is replaced atomically (temp file, fsync, rename), so a crash
+// during a save leaves either the old or the new contents. By default every
+// change is saved immediately; with a write-behind interval (see
+// SetDefaultWriteBehind) changes made within the interval are coalesced into
+// one save, and Flush writes pending changes at once.
 type FileCache struct {
 	filePath string
 	data     map[string]string
 	mu       sync.RWMutex
+
+	writeBehind time.Duration // 0 saves on every change
+	version     uint64        // incremented by every change, under mu
+	timer       *time.Timer   // pending write-behind save, under mu
+
+	saveMu sync.Mutex // serializes writes to the file
+	saved  uint64     // version last written, under saveMu
+}
+
+// defaultWriteBehind is the write-behind interval of new caches.
+var defaultWriteBehind time.Duration
+
+// cacheLockWait is how long NewFileCache waits for another process to
+// release a cache file.
+var cacheLockWait time.Duration
+
+// openCaches holds the open cache of every file, the number of callers
+// using it and the lock this process holds on the file. A file is opened
+// once per process; further NewFileCache calls share that cache until the
+// last caller closes it.
+var openCaches = struct {
+	sync.Mutex
+	byPath map[string]*FileCache
+	refs   map[string]int
+	locks  map[string]*FileLock
+}{byPath: make(map[string]*FileCache), refs: make(map[string]int), locks: make(map[string]*FileLock)}
+
+// opening serializes NewFileCache and Close, so a file is loaded and locked
+// by one caller at a time. It is not held by FlushCaches.
+var opening sync.Mutex
+
+// SetDefaultWriteBehind sets the write-behind interval of caches created
+// afterwards. With d > 0 changes are saved at most once per d; changes not
+// yet saved are lost on a crash, so the state they record (offsets,
+// watermarks) falls back to an earlier point and data is reprocessed.
+func SetDefaultWriteBehind(d time.Duration) {
+	openCaches.Lock()
+	defer openCaches.Unlock()
+	defaultWriteBehind = d
+}
+
+// SetCacheLockWait sets how long opening a cache file waits while another
+// process holds it before failing with ErrLocked.
+func SetCacheLockWait(d time.Duration) {
+	openCaches.Lock()
+	defer openCaches.Unlock()
+	cacheLockWait = d
+}
+
+// FlushCaches saves the pending changes of all open caches.
+func FlushCaches() error {
+	openCaches.Lock()
+	caches := make([]*FileCache, 0, len(openCaches.byPath))
+	for _, c := range openCaches.byPath {
+		caches = append(caches, c)
+	}
+	openCaches.Unlock()
+
+	var errs []error
+	for _, c := range caches {
+		if err := c.Flush(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CloseCaches saves the pending changes of all open caches and releases
+// their file locks. Caches must not be used afterwards.
+func CloseCaches() error {
+	err := FlushCaches()
+	opening.Lock()
+	defer opening.Unlock()
+	openCaches.Lock()
+	defer openCaches.Unlock()
+	for key, lock := range openCaches.locks {
+		if releaseErr := lock.Release(); releaseErr != nil {
+			err = errors.Join(err, releaseErr)
+		}
+		delete(openCaches.locks, key)
+	}
+	clear(openCaches.byPath)
+	clear(openCaches.refs)
+	return err
 }
 
 // NewFileCache creates or loads a cache from the specified file path.
+//
+// The first caller to open a file takes an advisory lock on
+// "<filePath>.lock", so two processes never update the same cache (see
+// SetCacheLockWait). Callers opening a file that is already open share its
+// cache. The lock is held until every caller has closed the cache, or until
+// CloseCaches or exit.
 func NewFileCache(filePath string) (*FileCache, error) {
+	key := filepath.Clean(filePath)
+	opening.Lock()
+	defer opening.Unlock()
+	openCaches.Lock()
+	if cache, ok := openCaches.byPath[key]; ok {
+		openCaches.refs[key]++
+		openCaches.Unlock()
+		return cache, nil
+	}
+	wait := cacheLockWait
+	writeBehind := defaultWriteBehind
+	openCaches.Unlock()
+
+	lock, err := AcquireFileLock(key+".lock", wait)
+	if err != nil {
+		return nil, fmt.Errorf("cache %s is in use: %w", key, err)
+	}
 	cache := &FileCache{
-		filePath: filePath,
-		data:     make(map[string]string),
+		filePath:    filePath,
+		data:        make(map[string]string),
+		writeBehind: writeBehind,
 	}
 	if err := cache.load(); err != nil && !os.IsNotExist(err) {
 		// Return error only if it's not a "file not found" error (we can create it)
+		lock.Release()
 		return nil, err
 	}
+	openCaches.Lock()
+	openCaches.byPath[key] = cache
+	openCaches.refs[key] = 1
+	openCaches.locks[key] = lock
+	openCaches.Unlock()
 	return cache, nil
 }
 
+// Close saves pending changes and ends this caller's use of the cache. Once
+// the last caller has closed it, the file lock is released and the next
+// NewFileCache loads the file again.
+func (c *FileCache) Close() error {
+	err := c.Flush()
+	key := filepath.Clean(c.filePath)
+	opening.Lock()
+	defer opening.Unlock()
+	openCaches.Lock()
+	defer openCaches.Unlock()
+	if openCaches.byPath[key] != c {
+		return err // already released by CloseCaches
+	}
+	if openCaches.refs[key]--; openCaches.refs[key] > 0 {
+		return err
+	}
+	delete(openCaches.byPath, key)
+	delete(openCaches.refs, key)
+	if lock, ok := openCaches.locks[key]; ok {
+		err = errors.Join(err, lock.Release())
+		delete(openCaches.locks, key)
+	}
+	return err
+}
+
 // load reads the cache data from the JSON file.
 func (c *FileCache) load() error {
 	c.mu.RLock()
@@ -43,31 +192,59 @@ func (c *FileCache) load() error {
 	return json.Unmarshal(data, &c.data)
 }
 
-// save writes the current cache data to the JSON file.
+// save writes the current cache data to the JSON file unless it has not
+// changed since the last save.
 func (c *FileCache) save() error {
+	c.saveMu.Lock()
+	defer c.saveMu.Unlock()
+
+	// Marshal under the read lock so concurrent changes cannot race with it.
 	c.mu.RLock()
-	// Read data and filePath under read lock
-	filePath := c.filePath
-	dataCopy := make(map[string]string)
-	for k, v := range c.data {
-		dataCopy[k] = v
+	version := c.version
+	if version == c.saved {
+		c.mu.RUnlock()
+		return nil
 	}
-	c.mu.RUnlock() // Release read lock before potentially slow I/O
-
 	data, err := json.MarshalIndent(c.data, "", "  ")
+	c.mu.RUnlock()
 	if err != nil {
 		return err
 	}
 
-	// Get the directory part of the file path
-	dir := filepath.Dir(filePath)
-	// Create the directory structure if it doesn't exist
-	// os.MkdirAll doesn't return an error if the path already exists.
-	if err := os.MkdirAll(dir, 0755); err != nil { // Use appropriate permissions
+	if err := WriteFileAtomic(c.filePath, data, 0644); err != nil {
 		return err
 	}
+	c.saved = version
+	return nil
+}
 
-	return os.WriteFile(c.filePath, data, 0644) // Use appropriate file permissions
+// changed records a change made under the write lock and saves it, either
+// now or, in write-behind mode, when the interval has passed. Callers hold
+// c.mu and must call the returned function after releasing it.
+func (c *FileCache) changed() func() error {
+	c.version++
+	if c.writeBehind <= 0 {
+		return c.save
+	}
+	if c.timer == nil {
+		c.timer = time.AfterFunc(c.writeBehind, func() {
+			if err := c.Flush(); err != nil {
+				log.Printf("Warning: failed to save cache %s: %v", c.filePath, err)
+			}
+		})
+	}
+	return func() error { return nil }
+}
+
+// Flush saves pending changes immediately.
+func (c *FileCache) Flush() error {
+	c.mu.Lock()
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	c.mu.Unlock()
+	return c.save()
 }
 
 // Get retrieves a value from the cache by key.
@@ -82,18 +259,66 @@ func (c *FileCache) Get(key string) (string, bool) {
 func (c *FileCache) Set(key, value string) error {
 	c.mu.Lock()
 	c.data[key] = value
+	save := c.changed()
 	c.mu.Unlock() // Unlock before saving to allow reads during potentially slow I/O
-
-	// Save the updated cache to the file
-	// Note: Frequent saves can be inefficient. Consider batching saves or saving on shutdown
-	// for more performance-critical applications.
-	return c.save()
+	return save()
 }
 
 // Delete removes a key from the cache and saves the change.
 func (c *FileCache) Delete(key string) error {
 	c.mu.Lock()
 	delete(c.data, key)
+	save := c.changed()
 	c.mu.Unlock()
-	return c.save()
-}
\ No newline at end of file
+	return save()
+}
+
+// Update applies fn to the cache contents under the write lock and saves the
+// result once. Use it to apply many changes without rewriting the file for
+// every key.
+func (c *FileCache) Update(fn func(data map[string]string)) error {
+	c.mu.Lock()
+	fn(c.data)
+	save := c.changed()
+	c.mu.Unlock()
+	return save()
+}
+
+// WriteFileAtomic replaces the file at path with data. The data is written
+// to a temporary file in the same directory, synced to disk and renamed over
+// path, so readers and crashes never see a partially written file.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	// Persist the rename itself; not supported on every platform.
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
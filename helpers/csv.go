@@ -0,0 +1,176 @@
+package helpers
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// CSVOptions configures CSVReader and CSVWriter. Unlike encoding/csv the
+// quote character is configurable.
+type CSVOptions struct {
+	Delimiter rune // field separator, default ','
+	Quote     rune // quote character, default '"'; a doubled quote inside a quoted field is a literal quote
+}
+
+func (o CSVOptions) withDefaults() CSVOptions {
+	if o.Delimiter == 0 {
+		o.Delimiter = ','
+	}
+	if o.Quote == 0 {
+		o.Quote = '"'
+	}
+	return o
+}
+
+// CSVReader reads CSV records one at a time from an underlying reader, so
+// large files never need to be held in memory. A leading UTF-8 byte order mark
+// is skipped, quoted fields may span lines, and rows may have differing
+// numbers of fields (the caller decides how to handle ragged rows).
+type CSVReader struct {
+	r       *bufio.Reader
+	opts    CSVOptions
+	line    int // physical line number of the last line read
+	started bool
+}
+
+// NewCSVReader returns a CSVReader reading from r.
+func NewCSVReader(r io.Reader, opts CSVOptions) *CSVReader {
+	return &CSVReader{r: bufio.NewReaderSize(r, 64*1024), opts: opts.withDefaults()}
+}
+
+// Line returns the physical line number on which the last returned record ended.
+func (c *CSVReader) Line() int {
+	return c.line
+}
+
+// Read returns the next record. It returns io.EOF when no records remain.
+// Empty lines are skipped.
+func (c *CSVReader) Read() ([]string, error) {
+	if !c.started {
+		c.started = true
+		if r, _, err := c.r.ReadRune(); err == nil && r != '\uFEFF' {
+			c.r.UnreadRune()
+		}
+	}
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if line == "" {
+			continue
+		}
+		return c.parse(line)
+	}
+}
+
+// readLine returns the next physical line without its line terminator.
+func (c *CSVReader) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	c.line++
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r"), nil
+}
+
+// parse splits a line into fields, reading further lines while a quoted
+// field is open.
+func (c *CSVReader) parse(line string) ([]string, error) {
+	var fields []string
+	var field strings.Builder
+	startLine := c.line
+	quoted, inQuotes := false, false
+
+	for {
+		runes := []rune(line)
+		for i := 0; i < len(runes); i++ {
+			r := runes[i]
+			switch {
+			case inQuotes && r == c.opts.Quote:
+				if i+1 < len(runes) && runes[i+1] == c.opts.Quote {
+					field.WriteRune(r)
+					i++
+				} else {
+					inQuotes = false
+				}
+			case inQuotes:
+				field.WriteRune(r)
+			case r == c.opts.Quote && field.Len() == 0 && !quoted:
+				inQuotes, quoted = true, true
+			case r == c.opts.Delimiter:
+				fields = append(fields, field.String())
+				field.Reset()
+				quoted = false
+			default:
+				field.WriteRune(r)
+			}
+		}
+		if !inQuotes {
+			break
+		}
+		// Quoted field continues on the next line.
+		next, err := c.readLine()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("line %d: unterminated quoted field", startLine)
+			}
+			return nil, err
+		}
+		field.WriteRune('\n')
+		line = next
+	}
+	return append(fields, field.String()), nil
+}
+
+// CSVWriter writes CSV records with a configurable delimiter and quote.
+type CSVWriter struct {
+	w    *bufio.Writer
+	opts CSVOptions
+}
+
+// NewCSVWriter returns a CSVWriter writing to w. Call Flush when done.
+func NewCSVWriter(w io.Writer, opts CSVOptions) *CSVWriter {
+	return &CSVWriter{w: bufio.NewWriter(w), opts: opts.withDefaults()}
+}
+
+// Write writes one record, quoting fields where necessary.
+func (c *CSVWriter) Write(fields []string) error {
+	for i, f := range fields {
+		if i > 0 {
+			if _, err := c.w.WriteRune(c.opts.Delimiter); err != nil {
+				return err
+			}
+		}
+		if !c.needsQuotes(f) {
+			if _, err := c.w.WriteString(f); err != nil {
+				return err
+			}
+			continue
+		}
+		q := string(c.opts.Quote)
+		escaped := q + strings.ReplaceAll(f, q, q+q) + q
+		if _, err := c.w.WriteString(escaped); err != nil {
+			return err
+		}
+	}
+	_, err := c.w.WriteString("\n")
+	return err
+}
+
+// Flush writes any buffered data to the underlying writer.
+func (c *CSVWriter) Flush() error {
+	return c.w.Flush()
+}
+
+func (c *CSVWriter) needsQuotes(f string) bool {
+	if f == "" {
+		return false
+	}
+	return strings.ContainsRune(f, c.opts.Delimiter) || strings.ContainsRune(f, c.opts.Quote) ||
+		strings.ContainsAny(f, "\r\n") || f[0] == ' ' || f[len(f)-1] == ' '
+}
@@ -0,0 +1,97 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrLocked is returned when a lock is held by another process.
+var ErrLocked = errors.New("locked by another process")
+
+// errWouldBlock is returned by tryLockFile when the lock is taken.
+var errWouldBlock = errors.New("lock is held")
+
+// lockPollInterval is how often AcquireFileLock retries while waiting.
+const lockPollInterval = 100 * time.Millisecond
+
+// FileLock is an advisory, exclusive lock on a file (flock on Unix,
+// LockFileEx on Windows). The operating system releases it when the holding
+// process exits, so a crashed process never blocks later runs.
+//
+// While held, the lock file records the holder ("pid=... host=...
+// since=..."); it is emptied on Release. A lock file that still names a
+// holder when the lock is acquired was left by a process that crashed, and
+// is reported as a released stale lock.
+type FileLock struct {
+	path string
+	file *os.File
+}
+
+// AcquireFileLock locks path, creating the file and its directory if needed.
+// If another process holds the lock it retries until wait has passed (or
+// fails immediately for wait <= 0) and then returns an error wrapping
+// ErrLocked that names the holder.
+func AcquireFileLock(path string, wait time.Duration) (*FileLock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(wait)
+	for {
+		err = tryLockFile(file)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, errWouldBlock) {
+			file.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+		if !time.Now().Before(deadline) {
+			holder := lockHolder(path)
+			file.Close()
+			return nil, fmt.Errorf("%s is %w (%s)", path, ErrLocked, holder)
+		}
+		time.Sleep(lockPollInterval)
+	}
+
+	if previous := lockHolder(path); previous != "unknown holder" {
+		log.Printf("Released stale lock %s left by crashed process (%s)", path, previous)
+	}
+	host, _ := os.Hostname()
+	info := fmt.Sprintf("pid=%d host=%s since=%s\n", os.Getpid(), host, time.Now().UTC().Format(time.RFC3339))
+	if err := file.Truncate(0); err == nil {
+		file.WriteAt([]byte(info), 0)
+	}
+	return &FileLock{path: path, file: file}, nil
+}
+
+// Release empties the lock file and releases the lock.
+func (l *FileLock) Release() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	l.file.Truncate(0)
+	err := unlockFile(l.file)
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	l.file = nil
+	return err
+}
+
+// lockHolder describes the process recorded in a lock file.
+func lockHolder(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil || len(strings.TrimSpace(string(data))) == 0 {
+		return "unknown holder"
+	}
+	return strings.TrimSpace(string(data))
+}
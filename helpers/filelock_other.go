@@ -0,0 +1,15 @@
+//go:build !unix && !windows
+
+package helpers
+
+import "os"
+
+// Platforms without file locking (e.g. wasip1) run without it.
+
+func tryLockFile(f *os.File) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
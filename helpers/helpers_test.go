@@ -0,0 +1,309 @@
+package helpers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInferSchema(t *testing.T) {
+	items := []interface{}{
+		map[string]interface{}{"id": 1, "email": "a@x.com", "properties": map[string]interface{}{"plan": "pro"}},
+		map[string]interface{}{"id": 2, "email": nil, "properties": map[string]interface{}{"plan": "free"}},
+		map[string]interface{}{"id": 3, "score": 1.5},
+		"not a record",
+	}
+	schema := InferSchema(items)
+	if schema.Records != 3 {
+		t.Fatalf("expected 3 records, got %d", schema.Records)
+	}
+	id := schema.Fields["id"]
+	if !reflect.DeepEqual(id.Types, []string{"integer"}) || id.Nullable || id.Cardinality != 3 {
+		t.Errorf("unexpected id schema: %+v", id)
+	}
+	if email := schema.Fields["email"]; !email.Nullable || email.Count != 1 {
+		t.Errorf("unexpected email schema: %+v", email)
+	}
+	if plan, ok := schema.Fields["properties.plan"]; !ok || plan.Cardinality != 2 {
+		t.Errorf("expected nested field properties.plan with 2 distinct values, got %+v", plan)
+	}
+}
+
+func TestCompareSchemas(t *testing.T) {
+	previous := InferSchema([]interface{}{map[string]interface{}{"id": 1, "email": "a@x.com", "age": 3}})
+	current := InferSchema([]interface{}{map[string]interface{}{"id": "1", "email": "a@x.com", "phone": "123"}})
+	var got []string
+	for _, c := range CompareSchemas(previous, current) {
+		got = append(got, c.Kind+":"+c.Field)
+	}
+	want := []string{"removed:age", "typeChanged:id", "added:phone"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestDistinctSketchEstimate(t *testing.T) {
+	s := newDistinctSketch(256)
+	for i := 0; i < 20000; i++ {
+		s.add(string(rune('a'+i%26)) + string(rune(i)))
+	}
+	if est := s.estimate(); est < 16000 || est > 24000 {
+		t.Errorf("estimate %d too far from 20000", est)
+	}
+}
+
+func TestCSVReader(t *testing.T) {
+	input := "\ufeffid;name;note\r\n1;'O''Brien';'multi\nline'\n\n2;Ann\n"
+	r := NewCSVReader(strings.NewReader(input), CSVOptions{Delimiter: ';', Quote: '\''})
+	var rows [][]string
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Read error: %v", err)
+		}
+		rows = append(rows, row)
+	}
+	want := [][]string{{"id", "name", "note"}, {"1", "O'Brien", "multi\nline"}, {"2", "Ann"}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("got %q, want %q", rows, want)
+	}
+}
+
+func TestCSVWriterRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewCSVWriter(&buf, CSVOptions{})
+	rows := [][]string{{"a", "b,c", `say "hi"`}, {"", " padded", "x"}}
+	for _, row := range rows {
+		if err := w.Write(row); err != nil {
+			t.Fatalf("Write error: %v", err)
+		}
+	}
+	w.Flush()
+	r := NewCSVReader(&buf, CSVOptions{})
+	for _, want := range rows {
+		got, err := r.Read()
+		if err != nil {
+			t.Fatalf("Read error: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestFileCacheConcurrentSetsAreSavedAtomically(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cache.json")
+	cache, err := NewFileCache(path)
+	if err != nil {
+		t.Fatalf("NewFileCache error: %v", err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := cache.Set(fmt.Sprintf("k%d", i), "v"); err != nil {
+				t.Errorf("Set error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	reloaded, err := NewFileCache(path)
+	if err != nil {
+		t.Fatalf("reload error: %v", err)
+	}
+	if len(reloaded.data) != 20 {
+		t.Errorf("expected 20 keys after reload, got %d", len(reloaded.data))
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if strings.Contains(e.Name(), ".tmp-") {
+			t.Errorf("temp file left behind: %s", e.Name())
+		}
+	}
+}
+
+func TestFileCacheWriteBehind(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+	SetDefaultWriteBehind(time.Hour)
+	defer SetDefaultWriteBehind(0)
+	cache, err := NewFileCache(path)
+	if err != nil {
+		t.Fatalf("NewFileCache error: %v", err)
+	}
+	cache.Set("offset", "1")
+	cache.Set("offset", "2")
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected no save before the write-behind interval, got %v", err)
+	}
+
+	// Reopening the file shares the open cache and its pending change.
+	reopened, err := NewFileCache(path)
+	if err != nil {
+		t.Fatalf("reopen error: %v", err)
+	}
+	if v, _ := reopened.Get("offset"); v != "2" {
+		t.Errorf("expected the pending change to be visible after reopening, got %q", v)
+	}
+
+	reopened.Set("offset", "3")
+	if err := FlushCaches(); err != nil {
+		t.Fatalf("FlushCaches error: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), `"3"`) {
+		t.Errorf("expected FlushCaches to save the change, file has %s", data)
+	}
+}
+
+func TestFileCacheCloseReleasesLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+	first, err := NewFileCache(path)
+	if err != nil {
+		t.Fatalf("NewFileCache error: %v", err)
+	}
+	second, err := NewFileCache(path)
+	if err != nil {
+		t.Fatalf("NewFileCache error: %v", err)
+	}
+	if first != second {
+		t.Fatal("expected callers opening the same file to share its cache")
+	}
+	first.Set("offset", "1")
+	first.Close()
+	if _, err := AcquireFileLock(path+".lock", 0); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected the file to stay locked while it is open, got %v", err)
+	}
+	second.Close()
+	lock, err := AcquireFileLock(path+".lock", 0)
+	if err != nil {
+		t.Fatalf("expected the last Close to release the lock, got %v", err)
+	}
+	lock.Release()
+
+	reopened, err := NewFileCache(path)
+	if err != nil {
+		t.Fatalf("reopen error: %v", err)
+	}
+	defer reopened.Close()
+	if v, _ := reopened.Get("offset"); v != "1" {
+		t.Errorf("expected the saved value after reopening, got %q", v)
+	}
+}
+
+func TestFileLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.lock")
+	// A crashed holder leaves its description behind but no lock.
+	os.WriteFile(path, []byte("pid=1 host=old since=2020-01-01T00:00:00Z\n"), 0644)
+	lock, err := AcquireFileLock(path, 0)
+	if err != nil {
+		t.Fatalf("expected the stale lock to be taken over, got %v", err)
+	}
+	if _, err := AcquireFileLock(path, 150*time.Millisecond); !errors.Is(err, ErrLocked) || !strings.Contains(err.Error(), fmt.Sprintf("pid=%d", os.Getpid())) {
+		t.Fatalf("expected ErrLocked naming the holder, got %v", err)
+	}
+	if err := lock.Release(); err != nil {
+		t.Fatalf("Release error: %v", err)
+	}
+	again, err := AcquireFileLock(path, 0)
+	if err != nil {
+		t.Fatalf("expected the released lock to be free, got %v", err)
+	}
+	again.Release()
+}
+
+func TestStateStoreBackends(t *testing.T) {
+	dir := t.TempDir()
+	for _, backend := range []string{StateBackendFile, StateBackendSQLite, StateBackendMemory} {
+		t.Run(backend, func(t *testing.T) {
+			base, err := OpenStateStore(backend, filepath.Join(dir, "state-"+backend))
+			if err != nil {
+				t.Fatalf("OpenStateStore error: %v", err)
+			}
+			store := NamespacedStateStore(base, "p/n/")
+			if err := store.Set("watermark", "10"); err != nil {
+				t.Fatalf("Set error: %v", err)
+			}
+			if v, ok, err := store.Get("watermark"); v != "10" || !ok || err != nil {
+				t.Errorf("Get: got %q, %v, %v", v, ok, err)
+			}
+			if v, ok, _ := base.Get("p/n/watermark"); v != "10" || !ok {
+				t.Errorf("expected the key to be namespaced, got %q, %v", v, ok)
+			}
+
+			if swapped, _ := store.CompareAndSwap("watermark", "9", "11"); swapped {
+				t.Error("CompareAndSwap with a stale value succeeded")
+			}
+			if swapped, _ := store.CompareAndSwap("watermark", "10", "11"); !swapped {
+				t.Error("CompareAndSwap with the current value failed")
+			}
+			if swapped, _ := store.CompareAndSwap("lease", "", "me"); !swapped {
+				t.Error("CompareAndSwap from a missing key failed")
+			}
+
+			if err := ApplyState(store, map[string]string{"file:a": "1", "file:b": "2"}, []string{"lease"}); err != nil {
+				t.Fatalf("ApplyState error: %v", err)
+			}
+			files, err := store.List("file:")
+			if err != nil || !reflect.DeepEqual(files, map[string]string{"file:a": "1", "file:b": "2"}) {
+				t.Errorf("List: got %v, %v", files, err)
+			}
+			store.Delete("file:a")
+			if _, ok, _ := store.Get("file:a"); ok {
+				t.Error("expected file:a to be deleted")
+			}
+			if all, _ := store.List(""); len(all) != 2 {
+				t.Errorf("expected watermark and file:b to remain, got %v", all)
+			}
+		})
+	}
+}
+
+func TestStagedStateStore(t *testing.T) {
+	base := NewMemoryStateStore()
+	base.Set("watermark", "10")
+	base.Set("seen:a", "1")
+	staged := NewStagedStateStore(base)
+
+	staged.Set("watermark", "20")
+	staged.Delete("seen:a")
+	ApplyState(staged, map[string]string{"seen:b": "2"}, nil)
+	if v, _, _ := staged.Get("watermark"); v != "20" {
+		t.Errorf("expected staged reads to see the new watermark, got %q", v)
+	}
+	if seen, _ := staged.List("seen:"); !reflect.DeepEqual(seen, map[string]string{"seen:b": "2"}) {
+		t.Errorf("List: got %v", seen)
+	}
+	if v, _, _ := base.Get("watermark"); v != "10" {
+		t.Errorf("expected the store to be unchanged before Commit, got %q", v)
+	}
+
+	staged.Discard()
+	if v, _, _ := staged.Get("watermark"); v != "10" || staged.Pending() {
+		t.Errorf("expected Discard to drop staged changes, got %q", v)
+	}
+
+	if swapped, _ := staged.CompareAndSwap("watermark", "10", "30"); !swapped {
+		t.Fatal("CompareAndSwap against the stored value failed")
+	}
+	staged.Delete("seen:a")
+	if err := staged.Commit(); err != nil {
+		t.Fatalf("Commit error: %v", err)
+	}
+	if all, _ := base.List(""); !reflect.DeepEqual(all, map[string]string{"watermark": "30"}) {
+		t.Errorf("after Commit: got %v", all)
+	}
+}
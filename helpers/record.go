@@ -0,0 +1,63 @@
+package helpers
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LookupPath returns the value stored under a dotted field path such as
+// "properties.email". A path without dots is a plain top-level lookup.
+func LookupPath(record map[string]interface{}, path string) (interface{}, bool) {
+	if v, ok := record[path]; ok || !strings.Contains(path, ".") {
+		return v, ok
+	}
+	var current interface{} = record
+	for _, part := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// ParseTime converts common timestamp representations into a time.Time.
+// Supported inputs are time.Time values, RFC3339 strings (with or without
+// fractional seconds), plain dates (2006-01-02) and numeric Unix epochs.
+// Epoch values larger than 1e12 are treated as milliseconds.
+func ParseTime(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case string:
+		s := strings.TrimSpace(t)
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"} {
+			if parsed, err := time.Parse(layout, s); err == nil {
+				return parsed, true
+			}
+		}
+		if n, err := strconv.ParseFloat(s, 64); err == nil {
+			return epochToTime(n), true
+		}
+	case float64:
+		return epochToTime(t), true
+	case int:
+		return epochToTime(float64(t)), true
+	case int64:
+		return epochToTime(float64(t)), true
+	}
+	return time.Time{}, false
+}
+
+// epochToTime interprets n as Unix seconds, or milliseconds for large values.
+func epochToTime(n float64) time.Time {
+	if n > 1e12 {
+		return time.UnixMilli(int64(n)).UTC()
+	}
+	sec := int64(n)
+	return time.Unix(sec, int64((n-float64(sec))*1e9)).UTC()
+}
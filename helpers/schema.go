@@ -0,0 +1,265 @@
+package helpers
+
+import (
+	"container/heap"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FieldSchema describes what was observed for a single field. Nested maps
+// are flattened into dotted field paths (e.g. "properties.email").
+type FieldSchema struct {
+	Types       []string `json:"types"`       // observed non-null types, sorted
+	Nullable    bool     `json:"nullable"`    // null or missing in at least one record
+	Count       int      `json:"count"`       // records with a non-null value
+	Cardinality int      `json:"cardinality"` // estimated number of distinct values
+}
+
+// Schema is the inferred schema of a set of records.
+type Schema struct {
+	Records int                     `json:"records"`
+	Fields  map[string]*FieldSchema `json:"fields"`
+}
+
+// SchemaBuilder infers a Schema from records added incrementally.
+type SchemaBuilder struct {
+	records int
+	fields  map[string]*fieldStats
+}
+
+// fieldStats accumulates observations for one field path.
+type fieldStats struct {
+	types  map[string]bool
+	nulls  int
+	count  int
+	values *distinctSketch
+}
+
+// NewSchemaBuilder returns an empty SchemaBuilder.
+func NewSchemaBuilder() *SchemaBuilder {
+	return &SchemaBuilder{fields: make(map[string]*fieldStats)}
+}
+
+// InferSchema is a convenience wrapper that infers the schema of items.
+func InferSchema(items []interface{}) *Schema {
+	b := NewSchemaBuilder()
+	b.Add(items...)
+	return b.Schema()
+}
+
+// Add observes records. Items that are not map[string]interface{} are ignored.
+func (b *SchemaBuilder) Add(items ...interface{}) {
+	for _, item := range items {
+		record, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		b.records++
+		b.addMap("", record)
+	}
+}
+
+// addMap records every field of m under the given path prefix.
+func (b *SchemaBuilder) addMap(prefix string, m map[string]interface{}) {
+	for k, v := range m {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		stats, ok := b.fields[path]
+		if !ok {
+			stats = &fieldStats{types: make(map[string]bool), values: newDistinctSketch(256)}
+			b.fields[path] = stats
+		}
+		typ := ValueType(v)
+		if typ == "null" {
+			stats.nulls++
+			continue
+		}
+		stats.types[typ] = true
+		stats.count++
+		if nested, ok := v.(map[string]interface{}); ok {
+			b.addMap(path, nested)
+			continue
+		}
+		if typ != "array" {
+			stats.values.add(typ + ":" + fmt.Sprint(v))
+		}
+	}
+}
+
+// Schema returns the schema inferred from the records added so far.
+func (b *SchemaBuilder) Schema() *Schema {
+	s := &Schema{Records: b.records, Fields: make(map[string]*FieldSchema, len(b.fields))}
+	for path, stats := range b.fields {
+		types := make([]string, 0, len(stats.types))
+		for t := range stats.types {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+		s.Fields[path] = &FieldSchema{
+			Types:       types,
+			Nullable:    stats.nulls > 0 || stats.count < b.records,
+			Count:       stats.count,
+			Cardinality: stats.values.estimate(),
+		}
+	}
+	return s
+}
+
+// ValueType returns the JSON-style type name of a record value: string,
+// integer, number, boolean, timestamp, object, array or null.
+func ValueType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return "integer"
+	case float32, float64:
+		return "number"
+	case time.Time:
+		return "timestamp"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// SchemaChange is a difference between two schemas of the same output.
+type SchemaChange struct {
+	Kind  string // "added", "removed" or "typeChanged"
+	Field string
+	From  []string // previous types (typeChanged)
+	To    []string // current types (typeChanged)
+}
+
+// String renders the change for logs and errors.
+func (c SchemaChange) String() string {
+	switch c.Kind {
+	case "added":
+		return fmt.Sprintf("field %q appeared", c.Field)
+	case "removed":
+		return fmt.Sprintf("field %q disappeared", c.Field)
+	}
+	return fmt.Sprintf("field %q changed type from [%s] to [%s]", c.Field, strings.Join(c.From, ","), strings.Join(c.To, ","))
+}
+
+// CompareSchemas reports fields that were added, removed or changed type
+// between previous and current. Fields that were only ever null on either side
+// are not reported as type changes. Changes are sorted by field.
+func CompareSchemas(previous, current *Schema) []SchemaChange {
+	var changes []SchemaChange
+	for field, prev := range previous.Fields {
+		curr, ok := current.Fields[field]
+		if !ok {
+			changes = append(changes, SchemaChange{Kind: "removed", Field: field})
+			continue
+		}
+		if len(prev.Types) > 0 && len(curr.Types) > 0 && !equalStrings(prev.Types, curr.Types) {
+			changes = append(changes, SchemaChange{Kind: "typeChanged", Field: field, From: prev.Types, To: curr.Types})
+		}
+	}
+	for field := range current.Fields {
+		if _, ok := previous.Fields[field]; !ok {
+			changes = append(changes, SchemaChange{Kind: "added", Field: field})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Field != changes[j].Field {
+			return changes[i].Field < changes[j].Field
+		}
+		return changes[i].Kind < changes[j].Kind
+	})
+	return changes
+}
+
+// equalStrings reports whether two sorted string slices are equal.
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// distinctSketch estimates the number of distinct values with a K-minimum
+// values sketch: it keeps the k smallest value hashes and extrapolates from
+// the k-th smallest. Below k distinct values the count is exact.
+type distinctSketch struct {
+	k      int
+	hashes hashHeap // max-heap of the k smallest hashes
+	member map[uint64]bool
+}
+
+func newDistinctSketch(k int) *distinctSketch {
+	return &distinctSketch{k: k, member: make(map[uint64]bool)}
+}
+
+func (s *distinctSketch) add(value string) {
+	h := fnv.New64a()
+	h.Write([]byte(value))
+	sum := mix64(h.Sum64())
+	if s.member[sum] {
+		return
+	}
+	if len(s.hashes) < s.k {
+		heap.Push(&s.hashes, sum)
+		s.member[sum] = true
+		return
+	}
+	if sum >= s.hashes[0] {
+		return
+	}
+	delete(s.member, s.hashes[0])
+	s.hashes[0] = sum
+	heap.Fix(&s.hashes, 0)
+	s.member[sum] = true
+}
+
+func (s *distinctSketch) estimate() int {
+	if len(s.hashes) < s.k {
+		return len(s.hashes)
+	}
+	kth := float64(s.hashes[0]) / math.MaxUint64
+	return int(float64(s.k-1) / kth)
+}
+
+// mix64 spreads FNV output uniformly over the 64-bit range (splitmix64
+// finalizer); raw FNV hashes of similar short strings cluster too much for
+// the estimate to be accurate.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// hashHeap is a max-heap of uint64 hashes.
+type hashHeap []uint64
+
+func (h hashHeap) Len() int            { return len(h) }
+func (h hashHeap) Less(i, j int) bool  { return h[i] > h[j] }
+func (h hashHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *hashHeap) Push(x interface{}) { *h = append(*h, x.(uint64)) }
+func (h *hashHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
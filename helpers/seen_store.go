@@ -0,0 +1,86 @@
+package helpers
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SeenKeyStore remembers record keys across pipeline runs, each with an
+// optional value (e.g. a version or content hash) and an expiry. It is backed
+// by a StateStore that it uses exclusively; entries are stored as
+// "<expiryUnix>|<value>", where an expiry of 0 means the entry never expires.
+type SeenKeyStore struct {
+	store StateStore
+	ttl   time.Duration
+	now   func() time.Time
+}
+
+// NewSeenKeyStore uses store for seen keys and drops expired entries.
+// A ttl <= 0 keeps entries forever.
+func NewSeenKeyStore(store StateStore, ttl time.Duration) (*SeenKeyStore, error) {
+	s := &SeenKeyStore{store: store, ttl: ttl, now: time.Now}
+	if err := s.purgeExpired(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Lookup returns the value recorded for key if the key was seen and has not
+// expired.
+func (s *SeenKeyStore) Lookup(key string) (string, bool, error) {
+	raw, ok, err := s.store.Get(key)
+	if err != nil || !ok {
+		return "", false, err
+	}
+	value, expired := s.decode(raw)
+	if expired {
+		return "", false, nil
+	}
+	return value, true, nil
+}
+
+// Record stores the given keys and values with a fresh expiry in a single save.
+func (s *SeenKeyStore) Record(entries map[string]string) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	var expiry int64
+	if s.ttl > 0 {
+		expiry = s.now().Add(s.ttl).Unix()
+	}
+	prefix := strconv.FormatInt(expiry, 10) + "|"
+	set := make(map[string]string, len(entries))
+	for k, v := range entries {
+		set[k] = prefix + v
+	}
+	return ApplyState(s.store, set, nil)
+}
+
+// purgeExpired removes expired entries from the backing store.
+func (s *SeenKeyStore) purgeExpired() error {
+	entries, err := s.store.List("")
+	if err != nil {
+		return err
+	}
+	var expired []string
+	for k, raw := range entries {
+		if _, isExpired := s.decode(raw); isExpired {
+			expired = append(expired, k)
+		}
+	}
+	return ApplyState(s.store, nil, expired)
+}
+
+// decode splits a stored entry into its value and whether it has expired.
+func (s *SeenKeyStore) decode(raw string) (string, bool) {
+	expStr, value, found := strings.Cut(raw, "|")
+	if !found {
+		return raw, false
+	}
+	expiry, err := strconv.ParseInt(expStr, 10, 64)
+	if err != nil {
+		return value, false
+	}
+	return value, expiry > 0 && s.now().Unix() >= expiry
+}
@@ -0,0 +1,165 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// FileStateStore is a StateStore kept in a JSON file. It is a FileCache, so
+// writes are atomic, the file is locked against other processes and changes
+// can be coalesced with write-behind (see SetDefaultWriteBehind).
+type FileStateStore struct {
+	cache *FileCache
+}
+
+// NewFileStateStore opens or creates the JSON state file at path.
+func NewFileStateStore(path string) (*FileStateStore, error) {
+	cache, err := NewFileCache(path)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStateStore{cache: cache}, nil
+}
+
+func (s *FileStateStore) Get(key string) (string, bool, error) {
+	v, ok := s.cache.Get(key)
+	return v, ok, nil
+}
+
+func (s *FileStateStore) Set(key, value string) error {
+	return s.cache.Set(key, value)
+}
+
+func (s *FileStateStore) Delete(key string) error {
+	return s.cache.Delete(key)
+}
+
+func (s *FileStateStore) CompareAndSwap(key, old, value string) (bool, error) {
+	c := s.cache
+	c.mu.Lock()
+	if !compareAndSwap(c.data, key, old, value) {
+		c.mu.Unlock()
+		return false, nil
+	}
+	save := c.changed()
+	c.mu.Unlock()
+	return true, save()
+}
+
+func (s *FileStateStore) List(prefix string) (map[string]string, error) {
+	s.cache.mu.RLock()
+	defer s.cache.mu.RUnlock()
+	return listPrefix(s.cache.data, prefix), nil
+}
+
+func (s *FileStateStore) Apply(set map[string]string, del []string) error {
+	return s.cache.Update(func(data map[string]string) {
+		applyChanges(data, set, del)
+	})
+}
+
+// Flush saves changes held back by write-behind.
+func (s *FileStateStore) Flush() error {
+	return s.cache.Flush()
+}
+
+// Close saves pending changes and releases the file (see FileCache.Close).
+func (s *FileStateStore) Close() error {
+	return s.cache.Close()
+}
+
+// SnapshotStateFile reads the JSON state file at path into a memory store
+// without opening it as a cache, so it takes no lock. Saves replace the file
+// atomically, so the snapshot is always a complete state; a missing file
+// gives an empty store.
+func SnapshotStateFile(path string) (*MemoryStateStore, error) {
+	store := NewMemoryStateStore()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &store.data); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+	return store, nil
+}
+
+// SharedFileStateStore is a StateStore kept in a JSON file that is opened,
+// and locked, only while it is in use: for the duration of each call, or
+// between Open and Close of the store Open returns. A long-running process
+// uses it for the shared state file, so other processes (such as
+// `data-pipeline state`) can use the file between runs.
+type SharedFileStateStore struct {
+	path string
+}
+
+// NewSharedFileStateStore returns a store for the JSON state file at path.
+// The file is not opened until the store is used.
+func NewSharedFileStateStore(path string) *SharedFileStateStore {
+	return &SharedFileStateStore{path: path}
+}
+
+// Open opens the file and keeps it open, so calls made meanwhile share it
+// instead of loading it again. Close the returned store when done.
+func (s *SharedFileStateStore) Open() (*FileStateStore, error) {
+	return NewFileStateStore(s.path)
+}
+
+// Snapshot returns a copy of the file's current contents without locking it
+// (see SnapshotStateFile).
+func (s *SharedFileStateStore) Snapshot() (*MemoryStateStore, error) {
+	return SnapshotStateFile(s.path)
+}
+
+// use runs fn with the file open.
+func (s *SharedFileStateStore) use(fn func(store *FileStateStore) error) error {
+	store, err := s.Open()
+	if err != nil {
+		return err
+	}
+	err = fn(store)
+	if closeErr := store.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (s *SharedFileStateStore) Get(key string) (value string, ok bool, err error) {
+	err = s.use(func(store *FileStateStore) error {
+		value, ok, err = store.Get(key)
+		return err
+	})
+	return value, ok, err
+}
+
+func (s *SharedFileStateStore) Set(key, value string) error {
+	return s.use(func(store *FileStateStore) error { return store.Set(key, value) })
+}
+
+func (s *SharedFileStateStore) Delete(key string) error {
+	return s.use(func(store *FileStateStore) error { return store.Delete(key) })
+}
+
+func (s *SharedFileStateStore) CompareAndSwap(key, old, value string) (swapped bool, err error) {
+	err = s.use(func(store *FileStateStore) error {
+		swapped, err = store.CompareAndSwap(key, old, value)
+		return err
+	})
+	return swapped, err
+}
+
+func (s *SharedFileStateStore) List(prefix string) (entries map[string]string, err error) {
+	err = s.use(func(store *FileStateStore) error {
+		entries, err = store.List(prefix)
+		return err
+	})
+	return entries, err
+}
+
+func (s *SharedFileStateStore) Apply(set map[string]string, del []string) error {
+	return s.use(func(store *FileStateStore) error { return store.Apply(set, del) })
+}
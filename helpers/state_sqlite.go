@@ -0,0 +1,117 @@
+package helpers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" database/sql driver
+)
+
+// SQLiteStateStore is a StateStore kept in a table of a SQLite database.
+// Unlike the JSON file, it can be shared by several processes at once and
+// queried with any SQLite client:
+//
+//	SELECT key, value FROM state WHERE key LIKE 'main_contact_flow/%';
+type SQLiteStateStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStateStore opens or creates the database at path and its state
+// table.
+func NewSQLiteStateStore(path string) (*SQLiteStateStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state database %s: %w", path, err)
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS state (key TEXT PRIMARY KEY, value TEXT NOT NULL)`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create state table in %s: %w", path, err)
+	}
+	return &SQLiteStateStore{db: db}, nil
+}
+
+func (s *SQLiteStateStore) Get(key string) (string, bool, error) {
+	var value string
+	err := s.db.QueryRow(`SELECT value FROM state WHERE key = ?`, key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+func (s *SQLiteStateStore) Set(key, value string) error {
+	_, err := s.db.Exec(`INSERT INTO state (key, value) VALUES (?, ?) ON CONFLICT (key) DO UPDATE SET value = excluded.value`, key, value)
+	return err
+}
+
+func (s *SQLiteStateStore) Delete(key string) error {
+	_, err := s.db.Exec(`DELETE FROM state WHERE key = ?`, key)
+	return err
+}
+
+func (s *SQLiteStateStore) CompareAndSwap(key, old, value string) (bool, error) {
+	var result sql.Result
+	var err error
+	if old == "" {
+		// A missing key, or one holding the empty string, matches.
+		result, err = s.db.Exec(`INSERT INTO state (key, value) VALUES (?, ?) ON CONFLICT (key) DO UPDATE SET value = excluded.value WHERE state.value = ''`, key, value)
+	} else {
+		result, err = s.db.Exec(`UPDATE state SET value = ? WHERE key = ? AND value = ?`, value, key, old)
+	}
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func (s *SQLiteStateStore) List(prefix string) (map[string]string, error) {
+	rows, err := s.db.Query(`SELECT key, value FROM state WHERE substr(key, 1, length(?1)) = ?1`, prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[string]string)
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return nil, err
+		}
+		out[k] = v
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteStateStore) Apply(set map[string]string, del []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for k, v := range set {
+		if _, err := tx.Exec(`INSERT INTO state (key, value) VALUES (?, ?) ON CONFLICT (key) DO UPDATE SET value = excluded.value`, k, v); err != nil {
+			return err
+		}
+	}
+	for _, k := range del {
+		if _, err := tx.Exec(`DELETE FROM state WHERE key = ?`, k); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Close closes the database.
+func (s *SQLiteStateStore) Close() error {
+	return s.db.Close()
+}
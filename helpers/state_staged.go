@@ -0,0 +1,134 @@
+package helpers
+
+import (
+	"strings"
+	"sync"
+)
+
+// StagedStateStore holds back the changes made to a store until Commit, so
+// a node's watermark or offset only moves once the records it read have been
+// persisted downstream. Reads see the staged changes; Discard drops them.
+//
+// CompareAndSwap is checked against the staged view and not again on Commit;
+// the pipeline run lock keeps other processes from changing the same keys.
+type StagedStateStore struct {
+	store StateStore
+
+	mu  sync.Mutex
+	set map[string]string
+	del map[string]bool
+}
+
+// NewStagedStateStore returns a store that stages changes to store.
+func NewStagedStateStore(store StateStore) *StagedStateStore {
+	return &StagedStateStore{store: store, set: make(map[string]string), del: make(map[string]bool)}
+}
+
+func (s *StagedStateStore) Get(key string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.get(key)
+}
+
+// get reads key through the staged changes; callers hold s.mu.
+func (s *StagedStateStore) get(key string) (string, bool, error) {
+	if v, ok := s.set[key]; ok {
+		return v, true, nil
+	}
+	if s.del[key] {
+		return "", false, nil
+	}
+	return s.store.Get(key)
+}
+
+func (s *StagedStateStore) Set(key, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.set[key] = value
+	delete(s.del, key)
+	return nil
+}
+
+func (s *StagedStateStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.set, key)
+	s.del[key] = true
+	return nil
+}
+
+func (s *StagedStateStore) CompareAndSwap(key, old, value string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, _, err := s.get(key)
+	if err != nil || current != old {
+		return false, err
+	}
+	s.set[key] = value
+	delete(s.del, key)
+	return true, nil
+}
+
+func (s *StagedStateStore) List(prefix string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries, err := s.store.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	for k := range s.del {
+		delete(entries, k)
+	}
+	for k, v := range s.set {
+		if strings.HasPrefix(k, prefix) {
+			entries[k] = v
+		}
+	}
+	return entries, nil
+}
+
+func (s *StagedStateStore) Apply(set map[string]string, del []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, v := range set {
+		s.set[k] = v
+		delete(s.del, k)
+	}
+	for _, k := range del {
+		delete(s.set, k)
+		s.del[k] = true
+	}
+	return nil
+}
+
+// Pending reports whether there are staged changes.
+func (s *StagedStateStore) Pending() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.set) > 0 || len(s.del) > 0
+}
+
+// Commit writes the staged changes to the underlying store in one write if
+// it supports it (see ApplyState). On error the changes stay staged.
+func (s *StagedStateStore) Commit() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	del := make([]string, 0, len(s.del))
+	for k := range s.del {
+		del = append(del, k)
+	}
+	if err := ApplyState(s.store, s.set, del); err != nil {
+		return err
+	}
+	s.set = make(map[string]string)
+	s.del = make(map[string]bool)
+	return nil
+}
+
+// Discard drops the staged changes.
+func (s *StagedStateStore) Discard() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.set = make(map[string]string)
+	s.del = make(map[string]bool)
+}
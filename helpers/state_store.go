@@ -0,0 +1,269 @@
+package helpers
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// StateStore holds the state nodes keep between runs, such as watermarks,
+// file positions, resume tokens and seen keys. Keys and values are strings.
+//
+// Nodes get a store from the orchestrator, namespaced by pipeline and node
+// name (see NamespacedStateStore), so several nodes can share one backend:
+// a JSON file, a SQLite database or memory (see OpenStateStore).
+type StateStore interface {
+	// Get returns the value stored under key and whether it exists.
+	Get(key string) (string, bool, error)
+	// Set stores value under key.
+	Set(key, value string) error
+	// Delete removes key; deleting a missing key is not an error.
+	Delete(key string) error
+	// CompareAndSwap stores value under key if the current value is old and
+	// reports whether it did. An empty old value matches a missing key.
+	CompareAndSwap(key, old, value string) (bool, error)
+	// List returns all entries whose key starts with prefix.
+	List(prefix string) (map[string]string, error)
+}
+
+// StateBatcher is implemented by stores that can apply several changes in
+// one write. Use ApplyState rather than calling it directly.
+type StateBatcher interface {
+	Apply(set map[string]string, del []string) error
+}
+
+// ApplyState stores the entries of set and deletes the keys in del, in one
+// write if the store supports it.
+func ApplyState(store StateStore, set map[string]string, del []string) error {
+	if len(set) == 0 && len(del) == 0 {
+		return nil
+	}
+	if b, ok := store.(StateBatcher); ok {
+		return b.Apply(set, del)
+	}
+	for k, v := range set {
+		if err := store.Set(k, v); err != nil {
+			return err
+		}
+	}
+	for _, k := range del {
+		if err := store.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Backends accepted by OpenStateStore.
+const (
+	StateBackendFile   = "file"
+	StateBackendSQLite = "sqlite"
+	StateBackendMemory = "memory"
+)
+
+// OpenStateStore opens a store of the given backend. path is the JSON file
+// or SQLite database and is ignored for memory stores. A JSON file is only
+// locked while it is in use (see SharedFileStateStore).
+func OpenStateStore(backend, path string) (StateStore, error) {
+	switch backend {
+	case StateBackendFile:
+		return NewSharedFileStateStore(path), nil
+	case StateBackendSQLite:
+		return NewSQLiteStateStore(path)
+	case StateBackendMemory:
+		return NewMemoryStateStore(), nil
+	}
+	return nil, fmt.Errorf("unknown state backend %q (want file, sqlite or memory)", backend)
+}
+
+// NamespacedStateStore returns a view of store in which every key is
+// prefixed with prefix, e.g. "main_contact_flow/ImportHubspotContacts/".
+func NamespacedStateStore(store StateStore, prefix string) StateStore {
+	return &namespacedStore{store: store, prefix: prefix}
+}
+
+type namespacedStore struct {
+	store  StateStore
+	prefix string
+}
+
+func (s *namespacedStore) Get(key string) (string, bool, error) {
+	return s.store.Get(s.prefix + key)
+}
+
+func (s *namespacedStore) Set(key, value string) error {
+	return s.store.Set(s.prefix+key, value)
+}
+
+func (s *namespacedStore) Delete(key string) error {
+	return s.store.Delete(s.prefix + key)
+}
+
+func (s *namespacedStore) CompareAndSwap(key, old, value string) (bool, error) {
+	return s.store.CompareAndSwap(s.prefix+key, old, value)
+}
+
+func (s *namespacedStore) List(prefix string) (map[string]string, error) {
+	entries, err := s.store.List(s.prefix + prefix)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]string, len(entries))
+	for k, v := range entries {
+		out[strings.TrimPrefix(k, s.prefix)] = v
+	}
+	return out, nil
+}
+
+func (s *namespacedStore) Apply(set map[string]string, del []string) error {
+	prefixed := make(map[string]string, len(set))
+	for k, v := range set {
+		prefixed[s.prefix+k] = v
+	}
+	keys := make([]string, len(del))
+	for i, k := range del {
+		keys[i] = s.prefix + k
+	}
+	return ApplyState(s.store, prefixed, keys)
+}
+
+// LazyStateStore returns a store that calls open on every use and forwards
+// the call to the store it returns. open is expected to open its store once
+// and return the same one afterwards; until the first call nothing is opened.
+func LazyStateStore(open func() (StateStore, error)) StateStore {
+	return &lazyStore{open: open}
+}
+
+type lazyStore struct {
+	open func() (StateStore, error)
+}
+
+func (s *lazyStore) Get(key string) (string, bool, error) {
+	store, err := s.open()
+	if err != nil {
+		return "", false, err
+	}
+	return store.Get(key)
+}
+
+func (s *lazyStore) Set(key, value string) error {
+	store, err := s.open()
+	if err != nil {
+		return err
+	}
+	return store.Set(key, value)
+}
+
+func (s *lazyStore) Delete(key string) error {
+	store, err := s.open()
+	if err != nil {
+		return err
+	}
+	return store.Delete(key)
+}
+
+func (s *lazyStore) CompareAndSwap(key, old, value string) (bool, error) {
+	store, err := s.open()
+	if err != nil {
+		return false, err
+	}
+	return store.CompareAndSwap(key, old, value)
+}
+
+func (s *lazyStore) List(prefix string) (map[string]string, error) {
+	store, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	return store.List(prefix)
+}
+
+func (s *lazyStore) Apply(set map[string]string, del []string) error {
+	store, err := s.open()
+	if err != nil {
+		return err
+	}
+	return ApplyState(store, set, del)
+}
+
+// MemoryStateStore keeps state in memory only; it is lost when the process
+// exits. It suits tests and pipelines that should start fresh every time.
+type MemoryStateStore struct {
+	mu   sync.RWMutex
+	data map[string]string
+}
+
+// NewMemoryStateStore returns an empty in-memory store.
+func NewMemoryStateStore() *MemoryStateStore {
+	return &MemoryStateStore{data: make(map[string]string)}
+}
+
+func (s *MemoryStateStore) Get(key string) (string, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.data[key]
+	return v, ok, nil
+}
+
+func (s *MemoryStateStore) Set(key, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = value
+	return nil
+}
+
+func (s *MemoryStateStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, key)
+	return nil
+}
+
+func (s *MemoryStateStore) CompareAndSwap(key, old, value string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return compareAndSwap(s.data, key, old, value), nil
+}
+
+func (s *MemoryStateStore) List(prefix string) (map[string]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return listPrefix(s.data, prefix), nil
+}
+
+func (s *MemoryStateStore) Apply(set map[string]string, del []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	applyChanges(s.data, set, del)
+	return nil
+}
+
+// compareAndSwap implements CompareAndSwap on a map.
+func compareAndSwap(data map[string]string, key, old, value string) bool {
+	if data[key] != old {
+		return false
+	}
+	data[key] = value
+	return true
+}
+
+// listPrefix copies the entries of data whose key starts with prefix.
+func listPrefix(data map[string]string, prefix string) map[string]string {
+	out := make(map[string]string)
+	for k, v := range data {
+		if strings.HasPrefix(k, prefix) {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// applyChanges implements StateBatcher.Apply on a map.
+func applyChanges(data map[string]string, set map[string]string, del []string) {
+	for k, v := range set {
+		data[k] = v
+	}
+	for _, k := range del {
+		delete(data, k)
+	}
+}
@@ -3,18 +3,26 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
 	"strings"
-	"data-pipeline/nodes"
+	"syscall"
+	"data-pipeline/helpers"
 	"gopkg.in/yaml.v3"
 )
 
 // AppConfig is the top-level config struct for YAML parsing.
 type AppConfig struct {
-	Pipelines map[string][]nodes.PipelineNode `yaml:"pipelines"`
+	Pipelines map[string]PipelineConfig `yaml:"pipelines"`
+	Cache     CacheConfig               `yaml:"cache"`
+	Locks     LockConfig                `yaml:"locks"`
+	State     StateConfig               `yaml:"state"`
+	Shutdown  ShutdownConfig            `yaml:"shutdown"`
 }
 
 // loadConfig reads the config YAML file from disk.
@@ -36,11 +44,82 @@ func loadConfig(path string) (*AppConfig, error) {
 	if len(cfg.Pipelines) == 0 {
 		return nil, fmt.Errorf("no pipelines defined in config file %s", path)
 	}
+	for name, pipelineCfg := range cfg.Pipelines {
+		if err := pipelineCfg.validate(); err != nil {
+			return nil, fmt.Errorf("pipeline %s in %s: %w", name, path, err)
+		}
+		cfg.Pipelines[name] = pipelineCfg
+	}
 
 	return &cfg, nil
 }
 
+// applySettings applies the process-wide settings of cfg: cache writing,
+// locks, the shutdown grace period and the shared state store.
+func applySettings(cfg *AppConfig) error {
+	helpers.SetDefaultWriteBehind(cfg.Cache.WriteBehind)
+	helpers.SetCacheLockWait(cfg.Locks.Wait)
+	pipelineLocks = cfg.Locks
+	shutdownGrace = defaultShutdownGrace
+	if cfg.Shutdown.Grace > 0 {
+		shutdownGrace = cfg.Shutdown.Grace
+	}
+	store, err := cfg.State.openStateStore()
+	if err != nil {
+		return fmt.Errorf("failed to open state store: %w", err)
+	}
+	stateStore = store
+	return nil
+}
+
+// releaseSettings saves pending cache changes and closes the caches and the
+// state store opened by applySettings.
+func releaseSettings() error {
+	err := helpers.CloseCaches()
+	if closer, ok := stateStore.(io.Closer); ok {
+		err = errors.Join(err, closer.Close())
+	}
+	return err
+}
+
+// exitInterrupted is the exit code of a command stopped by SIGINT or SIGTERM
+// (128 + SIGINT, as shells report it).
+const exitInterrupted = 130
+
+// interruptContext returns a context that is cancelled on the first SIGINT or
+// SIGTERM. The signal handler is removed at that point, so a second signal
+// ends the process at once. stop releases the handler.
+func interruptContext() (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		if sig, ok := <-signals; ok {
+			signal.Stop(signals)
+			log.Printf("Received %v: stopping; no new batches are started and running ones get up to %v to finish. Send the signal again to abort.", sig, shutdownGrace)
+			cancel()
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		close(signals)
+		cancel()
+	}
+}
+
 func main() {
+	// Subcommands come before the flags of a pipeline run.
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "state":
+			os.Exit(stateCommand(os.Args[2:], os.Stdout))
+		case "backfill":
+			os.Exit(backfillCommand(os.Args[2:]))
+		case "serve", "daemon":
+			os.Exit(serveCommand(os.Args[2:]))
+		}
+	}
+
 	// Define command-line flags
 	configFile := flag.String("config", "config.yaml", "Path to the configuration file")
 	// Use a comma-separated string for pipeline names, or potentially multiple flags
@@ -53,14 +132,17 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
+	if err := applySettings(cfg); err != nil {
+		log.Fatalf("%v", err)
+	}
 
 	// Determine which pipelines to run
-	var pipelinesToRun map[string][]nodes.PipelineNode
+	var pipelinesToRun map[string]PipelineConfig
 	if *pipelineNamesRaw == "" {
 		log.Printf("No specific pipelines requested, running all %d pipelines.", len(cfg.Pipelines))
 		pipelinesToRun = cfg.Pipelines
 	} else {
-		pipelinesToRun = make(map[string][]nodes.PipelineNode)
+		pipelinesToRun = make(map[string]PipelineConfig)
 		requestedNames := strings.Split(*pipelineNamesRaw, ",")
 		log.Printf("Requested pipelines: %v", requestedNames)
 		for _, name := range requestedNames {
@@ -76,16 +158,28 @@ func main() {
 		}
 	}
 
-	// Create a context for the pipelines
-	ctx := context.Background()
-	var runErrors []string
+	// Create a context for the pipelines; it is cancelled on SIGINT or SIGTERM
+	ctx, stop := interruptContext()
+	defer stop()
+	var runErrors, cancelled []string
 
 	// Run the selected pipelines
 	log.Printf("Starting execution for %d selected pipeline(s)...", len(pipelinesToRun))
 	for name, pipelineCfg := range pipelinesToRun {
+		if ctx.Err() != nil {
+			cancelled = append(cancelled, name+" (not started)")
+			continue
+		}
 		log.Printf("--- Running Pipeline: %s ---", name)
 		// Pass the pipeline name and its specific configuration
-		if err := RunPipeline(ctx, name, pipelineCfg); err != nil {
+		err := RunPipeline(ctx, name, pipelineCfg)
+		if err != nil && errors.Is(err, context.Canceled) && ctx.Err() != nil {
+			log.Printf("--- Pipeline '%s' cancelled ---", name)
+			cancelled = append(cancelled, name)
+		} else if err == nil && ctx.Err() != nil {
+			// Streaming pipelines end cleanly when stopped.
+			log.Printf("--- Pipeline '%s' stopped ---", name)
+		} else if err != nil {
 			errMsg := fmt.Sprintf("Pipeline '%s' failed: %v", name, err)
 			log.Printf("ERROR: %s", errMsg)
 			runErrors = append(runErrors, errMsg)
@@ -95,7 +189,23 @@ func main() {
 		log.Println("-----------------------------------------") // Separator
 	}
 
+	if err := releaseSettings(); err != nil {
+		log.Printf("Warning: failed to close caches: %v", err)
+	}
+
 	// Report final status
+	if ctx.Err() != nil {
+		if len(runErrors) > 0 {
+			log.Printf("One or more pipelines failed:\n- %s", strings.Join(runErrors, "\n- "))
+		}
+		if len(cancelled) > 0 {
+			log.Printf("Interrupted; cancelled pipelines:\n- %s", strings.Join(cancelled, "\n- "))
+		} else {
+			log.Println("Interrupted.")
+		}
+		stop()
+		os.Exit(exitInterrupted)
+	}
 	if len(runErrors) > 0 {
 		log.Fatalf("One or more pipelines failed:\n- %s", strings.Join(runErrors, "\n- "))
 	} else {
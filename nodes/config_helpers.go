@@ -0,0 +1,135 @@
+package nodes
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The helpers below read typed values out of a node's raw config map. YAML
+// decodes numbers as int while JSON (and tests) often use float64, so numeric
+// helpers accept both.
+
+// configString returns config[key] as a string, or def if missing or empty.
+func configString(config map[string]interface{}, key, def string) string {
+	if v, ok := config[key].(string); ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// configInt returns config[key] as an int, or def if missing.
+func configInt(config map[string]interface{}, key string, def int) int {
+	switch v := config[key].(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return def
+}
+
+// configBool returns config[key] as a bool, or def if missing.
+func configBool(config map[string]interface{}, key string, def bool) bool {
+	if v, ok := config[key].(bool); ok {
+		return v
+	}
+	return def
+}
+
+// configDuration parses config[key] as a time.Duration ("30m", "1h30m").
+// Plain numbers are interpreted as seconds.
+func configDuration(config map[string]interface{}, key string, def time.Duration) (time.Duration, error) {
+	switch v := config[key].(type) {
+	case nil:
+		return def, nil
+	case string:
+		if v == "" {
+			return def, nil
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration for %q: %w", key, err)
+		}
+		return d, nil
+	case int:
+		return time.Duration(v) * time.Second, nil
+	case float64:
+		return time.Duration(v * float64(time.Second)), nil
+	}
+	return 0, fmt.Errorf("invalid duration for %q: %v", key, config[key])
+}
+
+// configByteSize parses config[key] as a size in bytes. Strings may carry a
+// KB, MB or GB suffix (powers of 1024); plain numbers are bytes.
+func configByteSize(config map[string]interface{}, key string, def int64) (int64, error) {
+	switch v := config[key].(type) {
+	case nil:
+		return def, nil
+	case int:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case float64:
+		return int64(v), nil
+	case string:
+		s := strings.ToUpper(strings.TrimSpace(v))
+		if s == "" {
+			return def, nil
+		}
+		multiplier := int64(1)
+		for _, unit := range []struct {
+			suffix string
+			size   int64
+		}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+			if strings.HasSuffix(s, unit.suffix) {
+				s, multiplier = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix)), unit.size
+				break
+			}
+		}
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid size for %q: %q", key, v)
+		}
+		return int64(n * float64(multiplier)), nil
+	}
+	return 0, fmt.Errorf("invalid size for %q: %v", key, config[key])
+}
+
+// configStringSlice returns config[key] as a []string. A single string is
+// treated as a one-element list.
+func configStringSlice(config map[string]interface{}, key string) []string {
+	switch v := config[key].(type) {
+	case string:
+		if v != "" {
+			return []string{v}
+		}
+	case []string:
+		return v
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, e := range v {
+			if s, ok := e.(string); ok && s != "" {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// configRune returns the first character of config[key], or def if missing.
+// The names "tab" and "\t" select a tab character.
+func configRune(config map[string]interface{}, key string, def rune) rune {
+	s, ok := config[key].(string)
+	if !ok || s == "" {
+		return def
+	}
+	if s == "tab" || s == `\t` {
+		return '\t'
+	}
+	return []rune(s)[0]
+}
@@ -0,0 +1,338 @@
+package nodes
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"data-pipeline/helpers"
+)
+
+func init() {
+	Register("dedupe", NewDedupeNode)
+}
+
+// DedupeNodeConfig holds configuration for the dedupe node.
+type DedupeNodeConfig struct {
+	Keys              []string      `mapstructure:"keys"`              // Fields identifying a record (dotted paths allowed)
+	Mode              string        `mapstructure:"mode"`              // first (default), last or max
+	VersionField      string        `mapstructure:"versionField"`      // Field compared in "max" mode (number or timestamp)
+	PersistAcrossRuns bool          `mapstructure:"persistAcrossRuns"` // Remember keys between runs
+	CacheFilePath     string        `mapstructure:"cacheFilePath"`     // Seen-key store location
+	TTL               time.Duration `mapstructure:"ttl"`               // How long a seen key is remembered (0 = forever)
+}
+
+// DedupeNode drops duplicate records identified by one or more key fields.
+//
+// Modes:
+//   - first: the first record per key wins; records are emitted as they arrive.
+//   - last: the last record per key wins; records are emitted after the last batch.
+//   - max: the record with the highest versionField wins; emitted after the last batch.
+//
+// With persistAcrossRuns the node also remembers keys between runs in a
+// seen-key store. In first mode a key seen in an earlier run is dropped; in
+// last mode a record is dropped if its content is identical to the one
+// emitted before; in max mode it is dropped unless its version is newer.
+// Entries expire after ttl.
+//
+// Within a run "last" follows processing order, so use it with concurrency 1.
+//
+// # Pipeline configuration example
+//
+//	pipelines:
+//	  main_contact_flow:
+//	    - name: "DedupeContacts"
+//	      type: "dedupe"
+//	      concurrency: 1
+//	      config:
+//	        keys: ["id"]
+//	        mode: "max"                   // first | last | max
+//	        versionField: "updatedAt"     // required for mode "max"
+//	        persistAcrossRuns: true       // optional
+//	        ttl: "720h"                   // optional, default: keep forever
+//	        cacheFilePath: "./cache/dedupe_contacts_seen.json" // optional
+type DedupeNode struct {
+	nodeState
+	name   string
+	config DedupeNodeConfig
+	store  *helpers.SeenKeyStore // opened on first use with persistAcrossRuns
+
+	mu      sync.Mutex
+	seen    map[string]bool                   // keys seen in this run (first mode)
+	order   []string                          // keys in order of first appearance (last/max)
+	pending map[string]map[string]interface{} // current winner per key (last/max)
+	record  map[string]string                 // values to write to the store at the end of the run
+	emitted map[string]string                 // values emitted in earlier micro-batches (last/max, streaming)
+	dropped int
+}
+
+// NewDedupeNode creates a new instance of the dedupe node.
+func NewDedupeNode(name string, config map[string]interface{}) *DedupeNode {
+	nodeConfig := DedupeNodeConfig{
+		Keys:              configStringSlice(config, "keys"),
+		Mode:              strings.ToLower(configString(config, "mode", "first")),
+		VersionField:      configString(config, "versionField", ""),
+		PersistAcrossRuns: configBool(config, "persistAcrossRuns", false),
+		CacheFilePath:     configString(config, "cacheFilePath", fmt.Sprintf("./cache/%s_seen.json", name)),
+	}
+	ttl, err := configDuration(config, "ttl", 0)
+	if err != nil {
+		log.Printf("[%s] Warning: %v; seen keys will not expire.", name, err)
+	}
+	nodeConfig.TTL = ttl
+
+	node := &DedupeNode{
+		nodeState: nodeState{stateFile: nodeConfig.CacheFilePath},
+		name:      name,
+		config:    nodeConfig,
+		seen:      make(map[string]bool),
+		pending:   make(map[string]map[string]interface{}),
+		record:    make(map[string]string),
+		emitted:   make(map[string]string),
+	}
+
+	log.Printf("[%s] Initialized. Keys: %v, mode: %s, persistAcrossRuns: %v", name, nodeConfig.Keys, nodeConfig.Mode, nodeConfig.PersistAcrossRuns)
+	return node
+}
+
+// Name returns the node's name.
+func (n *DedupeNode) Name() string {
+	return n.name
+}
+
+// Process deduplicates a batch. In first mode unique records are returned
+// immediately; in last and max mode winners are held until Flush.
+func (n *DedupeNode) Process(ctx context.Context, items []interface{}) ([]interface{}, error) {
+	logPrefix := fmt.Sprintf("[%s]", n.Name())
+	if len(n.config.Keys) == 0 {
+		return nil, fmt.Errorf("%s 'keys' is not configured", logPrefix)
+	}
+	switch n.config.Mode {
+	case "first", "last":
+	case "max":
+		if n.config.VersionField == "" {
+			return nil, fmt.Errorf("%s 'versionField' is required for mode 'max'", logPrefix)
+		}
+	default:
+		return nil, fmt.Errorf("%s unsupported mode: '%s'", logPrefix, n.config.Mode)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.openSeenKeys(); err != nil {
+		return nil, fmt.Errorf("%s %w", logPrefix, err)
+	}
+
+	var output []interface{}
+	for i, item := range items {
+		record, ok := item.(map[string]interface{})
+		if !ok {
+			log.Printf("%s Warning: Passing through item %d as it's not a map[string]interface{}", logPrefix, i)
+			output = append(output, item)
+			continue
+		}
+		key, ok := joinKey(record, n.config.Keys)
+		if !ok {
+			log.Printf("%s Warning: Passing through item %d as a key field is missing", logPrefix, i)
+			output = append(output, record)
+			continue
+		}
+
+		switch n.config.Mode {
+		case "first":
+			if n.seen[key] || n.seenInEarlierRun(key) {
+				n.dropped++
+				continue
+			}
+			n.seen[key] = true
+			n.record[key] = ""
+			output = append(output, record)
+		case "last":
+			if _, exists := n.pending[key]; exists {
+				n.dropped++
+			} else {
+				n.order = append(n.order, key)
+			}
+			n.pending[key] = record
+		case "max":
+			current, exists := n.pending[key]
+			if !exists {
+				n.order = append(n.order, key)
+				n.pending[key] = record
+				continue
+			}
+			n.dropped++
+			if compareVersions(record[n.config.VersionField], current[n.config.VersionField]) > 0 {
+				n.pending[key] = record
+			}
+		}
+	}
+	return output, nil
+}
+
+// Flush emits the winners of last/max mode and persists the seen keys. In
+// streaming runs it runs per micro-batch; the keys seen so far are kept, so
+// duplicates are also dropped across micro-batches.
+func (n *DedupeNode) Flush(ctx context.Context) ([]interface{}, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.openSeenKeys(); err != nil {
+		return nil, fmt.Errorf("[%s] %w", n.Name(), err)
+	}
+
+	var output []interface{}
+	for _, key := range n.order {
+		record := n.pending[key]
+		var value string
+		if n.config.Mode == "max" {
+			value = versionString(record[n.config.VersionField])
+		} else {
+			value = contentHash(record)
+		}
+		previous, seen := n.emitted[key]
+		if !seen {
+			previous, seen = n.lookupEarlierRun(key)
+		}
+		if seen {
+			if n.config.Mode == "max" && compareVersions(value, previous) <= 0 ||
+				n.config.Mode == "last" && value == previous {
+				n.dropped++
+				continue
+			}
+		}
+		n.record[key] = value
+		output = append(output, record)
+	}
+
+	if n.store != nil {
+		if err := n.store.Record(n.record); err != nil {
+			return nil, fmt.Errorf("[%s] failed to persist seen keys: %w", n.Name(), err)
+		}
+	}
+	log.Printf("[%s] Dropped %d duplicate(s).", n.Name(), n.dropped)
+
+	if info, ok := RunInfoFromContext(ctx); ok && info.Streaming {
+		if n.config.Mode != "first" {
+			for key, value := range n.record {
+				n.emitted[key] = value
+			}
+		}
+	} else {
+		n.seen = make(map[string]bool)
+	}
+	n.order = nil
+	n.pending = make(map[string]map[string]interface{})
+	n.record = make(map[string]string)
+	n.dropped = 0
+	return output, nil
+}
+
+// openSeenKeys opens the seen-key store on first use if keys persist across
+// runs. Callers hold n.mu.
+func (n *DedupeNode) openSeenKeys() error {
+	if !n.config.PersistAcrossRuns || n.store != nil {
+		return nil
+	}
+	state, err := n.StateStore()
+	if err != nil {
+		return fmt.Errorf("failed to open seen-key store: %w", err)
+	}
+	if n.store, err = helpers.NewSeenKeyStore(state, n.config.TTL); err != nil {
+		return fmt.Errorf("failed to open seen-key store: %w", err)
+	}
+	return nil
+}
+
+// seenInEarlierRun reports whether key was recorded by a previous run.
+func (n *DedupeNode) seenInEarlierRun(key string) bool {
+	_, seen := n.lookupEarlierRun(key)
+	return seen
+}
+
+// lookupEarlierRun returns the value stored for key by a previous run.
+func (n *DedupeNode) lookupEarlierRun(key string) (string, bool) {
+	if n.store == nil {
+		return "", false
+	}
+	value, seen, err := n.store.Lookup(key)
+	if err != nil {
+		log.Printf("[%s] Warning: failed to look up key %q in seen-key store: %v", n.Name(), key, err)
+	}
+	return value, seen
+}
+
+// compareVersions orders two version values. Numbers (or numeric strings) are
+// compared numerically, timestamps chronologically and anything else as
+// strings. Missing values sort first.
+func compareVersions(a, b interface{}) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1
+		}
+		return 1
+	}
+	if fa, ok := versionNumber(a); ok {
+		if fb, ok := versionNumber(b); ok {
+			switch {
+			case fa < fb:
+				return -1
+			case fa > fb:
+				return 1
+			}
+			return 0
+		}
+	}
+	if ta, ok := helpers.ParseTime(a); ok {
+		if tb, ok := helpers.ParseTime(b); ok {
+			return ta.Compare(tb)
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// versionNumber converts numeric values and numeric strings to float64.
+func versionNumber(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case int:
+		return float64(t), true
+	case int64:
+		return float64(t), true
+	case string:
+		f, err := strconv.ParseFloat(t, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// versionString renders a version value for the seen-key store.
+func versionString(v interface{}) string {
+	if t, ok := v.(time.Time); ok {
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// contentHash returns a stable hash of a record's JSON encoding.
+func contentHash(record map[string]interface{}) string {
+	data, err := json.Marshal(record) // map keys are sorted, so this is stable
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,218 @@
+package nodes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"data-pipeline/helpers"
+)
+
+func init() {
+	Register("exportCSV", NewExportCSVNode)
+}
+
+// ExportCSVNodeConfig holds configuration for the CSV export node.
+type ExportCSVNodeConfig struct {
+	DestinationFile string   `mapstructure:"destinationFile"` // Path of the CSV file to write
+	Delimiter       rune     `mapstructure:"delimiter"`       // Field separator (default ",")
+	Quote           rune     `mapstructure:"quote"`           // Quote character (default '"')
+	Header          bool     `mapstructure:"header"`          // Write a header row (default true)
+	Columns         []string `mapstructure:"columns"`         // Column order; dotted paths allowed
+}
+
+// ExportCSVNode writes records to a CSV file and passes them through. The
+// column order is stable: it comes from `columns` or, if not configured, from
+// the sorted field names of the first record.
+//
+// # Pipeline configuration example
+//
+//	pipelines:
+//	  partner_feed:
+//	    - name: "ExportReport"
+//	      type: "exportCSV"
+//	      concurrency: 1
+//	      config:
+//	        destinationFile: "./out/report.csv"
+//	        columns: ["id", "name", "properties.email"] // optional
+//	        delimiter: ";"                               // optional, default ","
+//
+// Nulls are written as empty fields, timestamps as RFC3339 and nested
+// values as JSON. In streaming runs the file stays open across micro-batches
+// and is finished when the pipeline stops.
+type ExportCSVNode struct {
+	name   string
+	config ExportCSVNodeConfig
+
+	mu        sync.Mutex
+	file      *os.File
+	writer    *helpers.CSVWriter
+	columns   []string
+	written   int
+	streaming bool // the file is finished by Close
+}
+
+// NewExportCSVNode creates a new instance of the CSV export node.
+func NewExportCSVNode(name string, config map[string]interface{}) *ExportCSVNode {
+	nodeConfig := ExportCSVNodeConfig{
+		DestinationFile: configString(config, "destinationFile", ""),
+		Delimiter:       configRune(config, "delimiter", ','),
+		Quote:           configRune(config, "quote", '"'),
+		Header:          configBool(config, "header", true),
+		Columns:         configStringSlice(config, "columns"),
+	}
+	log.Printf("[%s] Initialized. Destination file: %s", name, nodeConfig.DestinationFile)
+	return &ExportCSVNode{name: name, config: nodeConfig, columns: nodeConfig.Columns}
+}
+
+// Name returns the node's name.
+func (n *ExportCSVNode) Name() string {
+	return n.name
+}
+
+// Process appends a batch to the CSV file and returns the items unchanged.
+func (n *ExportCSVNode) Process(ctx context.Context, items []interface{}) ([]interface{}, error) {
+	logPrefix := fmt.Sprintf("[%s]", n.Name())
+	if n.config.DestinationFile == "" {
+		return nil, fmt.Errorf("%s 'destinationFile' is not configured", logPrefix)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for i, item := range items {
+		record, ok := item.(map[string]interface{})
+		if !ok {
+			log.Printf("%s Warning: Skipping item %d as it's not a map[string]interface{}", logPrefix, i)
+			continue
+		}
+		if len(n.columns) == 0 {
+			for k := range record {
+				n.columns = append(n.columns, k)
+			}
+			sort.Strings(n.columns)
+		}
+		if err := n.open(); err != nil {
+			return nil, fmt.Errorf("%s %w", logPrefix, err)
+		}
+		row := make([]string, len(n.columns))
+		for c, col := range n.columns {
+			value, _ := helpers.LookupPath(record, col)
+			row[c] = csvField(value)
+		}
+		if err := n.writer.Write(row); err != nil {
+			return nil, fmt.Errorf("%s failed to write %s: %w", logPrefix, n.config.DestinationFile, err)
+		}
+		n.written++
+	}
+	return items, nil
+}
+
+// Flush finishes the file once all batches are written. If no records were
+// written but columns are configured, a header-only file is produced. In
+// streaming runs the rows of the micro-batch are written out and the file is
+// kept open.
+func (n *ExportCSVNode) Flush(ctx context.Context) ([]interface{}, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if info, ok := RunInfoFromContext(ctx); ok && info.Streaming {
+		n.streaming = true
+		if n.writer == nil {
+			return nil, nil
+		}
+		if err := n.writer.Flush(); err != nil {
+			return nil, fmt.Errorf("[%s] failed to write %s: %w", n.Name(), n.config.DestinationFile, err)
+		}
+		return nil, nil
+	}
+	if n.file == nil && len(n.columns) > 0 && n.config.DestinationFile != "" {
+		if err := n.open(); err != nil {
+			return nil, fmt.Errorf("[%s] %w", n.Name(), err)
+		}
+	}
+	if n.file == nil {
+		return nil, nil
+	}
+	if err := n.closeFile(); err != nil {
+		return nil, fmt.Errorf("[%s] failed to finish %s: %w", n.Name(), n.config.DestinationFile, err)
+	}
+	log.Printf("[%s] Wrote %d record(s) to %s", n.Name(), n.written, n.config.DestinationFile)
+	n.written = 0
+	n.columns = n.config.Columns
+	return nil, nil
+}
+
+// Close finishes the file of a streaming run, or releases the file if the
+// pipeline stopped before Flush.
+func (n *ExportCSVNode) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.file == nil {
+		return nil
+	}
+	if err := n.closeFile(); err != nil {
+		return err
+	}
+	if n.streaming {
+		log.Printf("[%s] Wrote %d record(s) to %s", n.Name(), n.written, n.config.DestinationFile)
+	}
+	return nil
+}
+
+// open creates the destination file and writes the header on first use.
+func (n *ExportCSVNode) open() error {
+	if n.file != nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(n.config.DestinationFile), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(n.config.DestinationFile)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", n.config.DestinationFile, err)
+	}
+	n.file = file
+	n.writer = helpers.NewCSVWriter(file, helpers.CSVOptions{Delimiter: n.config.Delimiter, Quote: n.config.Quote})
+	if n.config.Header {
+		return n.writer.Write(n.columns)
+	}
+	return nil
+}
+
+// closeFile flushes buffered rows and closes the file.
+func (n *ExportCSVNode) closeFile() error {
+	flushErr := n.writer.Flush()
+	closeErr := n.file.Close()
+	n.file, n.writer = nil, nil
+	if flushErr != nil {
+		return flushErr
+	}
+	return closeErr
+}
+
+// csvField renders a record value as a CSV field.
+func csvField(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case time.Time:
+		return t.Format(time.RFC3339Nano)
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(t)
+		if err != nil {
+			return fmt.Sprint(t)
+		}
+		return string(data)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,348 @@
+package nodes
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	Register("exportFile", NewExportFileNode)
+}
+
+// ExportFileNodeConfig holds configuration for the file export node.
+type ExportFileNodeConfig struct {
+	DestinationFile string        `mapstructure:"destinationFile"` // Path template of the file(s) to write
+	Format          string        `mapstructure:"format"`          // jsonl (default) or json (a single array)
+	Compression     string        `mapstructure:"compression"`     // auto (default, by extension), gzip or none
+	Atomic          bool          `mapstructure:"atomic"`          // Write to a temp file and rename when done (default true)
+	RotateEvery     time.Duration `mapstructure:"rotateEvery"`     // Start a new file after this long (0 = never)
+	MaxFileSize     int64         `mapstructure:"maxFileSize"`     // Start a new file after this many bytes (0 = no limit)
+}
+
+// ExportFileNode writes records to JSON Lines or JSON array files and passes
+// them through unchanged.
+//
+// # Pipeline configuration example
+//
+//	pipelines:
+//	  log_aggregation:
+//	    - name: "ArchiveEvents"
+//	      type: "exportFile"
+//	      config:
+//	        destinationFile: "./archive/{{pipeline}}/{{date}}/{{runId}}.jsonl.gz"
+//	        format: "jsonl"      // optional: jsonl | json
+//	        compression: "auto"  // optional: auto (by extension) | gzip | none
+//	        atomic: true         // optional, default true
+//	        rotateEvery: "1h"    // optional
+//	        maxFileSize: "100MB" // optional, measured before compression
+//
+// The destination supports the placeholders {{pipeline}}, {{runId}}, {{date}}
+// (YYYY-MM-DD, UTC), {{time}} (YYYYMMDDTHHMMSSZ) and {{part}} (a counter of
+// the files written by this run). If rotation is configured and the template
+// has no {{part}}, "-{{part}}" is inserted before the file extension.
+//
+// With atomic writes a file only appears under its final name once it is
+// complete; a run that fails leaves no partial file behind. A file is finished
+// when the node has seen all batches of the run, or when it is rotated. In
+// streaming runs the file stays open across micro-batches until it is rotated
+// or the pipeline stops.
+type ExportFileNode struct {
+	name   string
+	config ExportFileNodeConfig
+
+	mu        sync.Mutex
+	current   *exportFile
+	part      int
+	streaming bool
+}
+
+// exportFile is a destination file that is being written.
+type exportFile struct {
+	path     string // final path
+	tempPath string // path written to; equals path unless atomic
+	file     *os.File
+	gzip     *gzip.Writer
+	buf      *bufio.Writer
+	opened   time.Time
+	bytes    int64 // uncompressed bytes written
+	records  int
+}
+
+// NewExportFileNode creates a new instance of the file export node.
+func NewExportFileNode(name string, config map[string]interface{}) *ExportFileNode {
+	nodeConfig := ExportFileNodeConfig{
+		DestinationFile: configString(config, "destinationFile", ""),
+		Format:          strings.ToLower(configString(config, "format", "jsonl")),
+		Compression:     strings.ToLower(configString(config, "compression", "auto")),
+		Atomic:          configBool(config, "atomic", true),
+	}
+	rotateEvery, err := configDuration(config, "rotateEvery", 0)
+	if err != nil || rotateEvery < 0 {
+		log.Printf("[%s] Warning: invalid 'rotateEvery' in config (%v); time-based rotation disabled.", name, config["rotateEvery"])
+		rotateEvery = 0
+	}
+	nodeConfig.RotateEvery = rotateEvery
+	maxFileSize, err := configByteSize(config, "maxFileSize", 0)
+	if err != nil {
+		log.Printf("[%s] Warning: %v; size-based rotation disabled.", name, err)
+	}
+	nodeConfig.MaxFileSize = maxFileSize
+
+	log.Printf("[%s] Initialized. Destination: %s (format: %s)", name, nodeConfig.DestinationFile, nodeConfig.Format)
+	return &ExportFileNode{name: name, config: nodeConfig}
+}
+
+// Name returns the node's name.
+func (n *ExportFileNode) Name() string {
+	return n.name
+}
+
+// Process appends a batch to the current file and returns the items unchanged.
+func (n *ExportFileNode) Process(ctx context.Context, items []interface{}) ([]interface{}, error) {
+	logPrefix := fmt.Sprintf("[%s]", n.Name())
+	if n.config.DestinationFile == "" {
+		return nil, fmt.Errorf("%s 'destinationFile' is not configured", logPrefix)
+	}
+	if n.config.Format != "jsonl" && n.config.Format != "json" {
+		return nil, fmt.Errorf("%s unsupported format: '%s'", logPrefix, n.config.Format)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, item := range items {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return nil, fmt.Errorf("%s failed to encode record: %w", logPrefix, err)
+		}
+		if n.current != nil && n.rotationDue() {
+			if err := n.finish(); err != nil {
+				return nil, fmt.Errorf("%s %w", logPrefix, err)
+			}
+		}
+		if n.current == nil {
+			if err := n.open(ctx); err != nil {
+				return nil, fmt.Errorf("%s %w", logPrefix, err)
+			}
+		}
+		if err := n.current.writeRecord(data, n.config.Format); err != nil {
+			return nil, fmt.Errorf("%s failed to write %s: %w", logPrefix, n.current.path, err)
+		}
+	}
+	return items, nil
+}
+
+// Flush finishes the current file once all batches of the run are written.
+// In streaming runs the file is kept open unless it is due for rotation.
+func (n *ExportFileNode) Flush(ctx context.Context) ([]interface{}, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.current == nil {
+		return nil, nil
+	}
+	if info, ok := RunInfoFromContext(ctx); ok && info.Streaming && !n.rotationDue() {
+		return nil, nil
+	}
+	if err := n.finish(); err != nil {
+		return nil, fmt.Errorf("[%s] %w", n.Name(), err)
+	}
+	return nil, nil
+}
+
+// Close finishes the open file of a streaming run. In other runs a file is
+// only still open if the pipeline failed; with atomic writes it is discarded.
+func (n *ExportFileNode) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.current == nil {
+		return nil
+	}
+	if n.config.Atomic && !n.streaming {
+		log.Printf("[%s] Discarding unfinished %s", n.Name(), n.current.path)
+		return n.discard()
+	}
+	return n.finish()
+}
+
+// rotationDue reports whether the current file has reached its age or size
+// limit.
+func (n *ExportFileNode) rotationDue() bool {
+	if n.config.RotateEvery > 0 && time.Since(n.current.opened) >= n.config.RotateEvery {
+		return true
+	}
+	return n.config.MaxFileSize > 0 && n.current.bytes >= n.config.MaxFileSize
+}
+
+// open starts the next destination file.
+func (n *ExportFileNode) open(ctx context.Context) error {
+	n.part++
+	now := time.Now()
+	path := n.destinationPath(ctx, now)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	f := &exportFile{path: path, tempPath: path, opened: now}
+	var err error
+	if n.config.Atomic {
+		f.tempPath = tempPathFor(path)
+	}
+	if f.file, err = os.Create(f.tempPath); err != nil {
+		return fmt.Errorf("failed to create %s: %w", f.tempPath, err)
+	}
+	var w io.Writer = f.file
+	if n.compressed(path) {
+		f.gzip = gzip.NewWriter(f.file)
+		w = f.gzip
+	}
+	f.buf = bufio.NewWriterSize(w, 64*1024)
+	if n.config.Format == "json" {
+		if _, err := f.buf.WriteString("["); err != nil {
+			f.file.Close()
+			return err
+		}
+	}
+	n.current = f
+	return nil
+}
+
+// destinationPath renders the destination template for the next file.
+func (n *ExportFileNode) destinationPath(ctx context.Context, now time.Time) string {
+	tmpl := n.config.DestinationFile
+	if (n.config.RotateEvery > 0 || n.config.MaxFileSize > 0) && !strings.Contains(tmpl, "{{part}}") {
+		dir, base := filepath.Split(tmpl)
+		if i := strings.Index(base, "."); i > 0 {
+			base = base[:i] + "-{{part}}" + base[i:]
+		} else {
+			base += "-{{part}}"
+		}
+		tmpl = dir + base
+	}
+	info, _ := RunInfoFromContext(ctx)
+	n.streaming = info.Streaming
+	return expandPathTemplate(ctx, tmpl, now, n.part)
+}
+
+// expandPathTemplate replaces the {{pipeline}}, {{runId}}, {{date}}, {{time}}
+// and {{part}} placeholders of a destination path.
+func expandPathTemplate(ctx context.Context, tmpl string, now time.Time, part int) string {
+	info, _ := RunInfoFromContext(ctx)
+	if info.Pipeline == "" {
+		info.Pipeline = "pipeline"
+	}
+	if info.RunID == "" {
+		info.RunID = now.UTC().Format("20060102T150405Z")
+	}
+	return strings.NewReplacer(
+		"{{pipeline}}", info.Pipeline,
+		"{{runId}}", info.RunID,
+		"{{date}}", now.UTC().Format("2006-01-02"),
+		"{{time}}", now.UTC().Format("20060102T150405Z"),
+		"{{part}}", fmt.Sprintf("%04d", part),
+	).Replace(tmpl)
+}
+
+// tempPathFor returns a hidden, unique path next to path for atomic writes.
+func tempPathFor(path string) string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp-"+hex.EncodeToString(suffix))
+}
+
+// compressed reports whether a destination is written with gzip.
+func (n *ExportFileNode) compressed(path string) bool {
+	switch n.config.Compression {
+	case "gzip":
+		return true
+	case "none":
+		return false
+	}
+	return strings.HasSuffix(strings.ToLower(path), ".gz")
+}
+
+// finish completes the current file and moves it to its final name.
+func (n *ExportFileNode) finish() error {
+	f := n.current
+	n.current = nil
+	if err := f.close(n.config.Format); err != nil {
+		if f.tempPath != f.path {
+			os.Remove(f.tempPath)
+		}
+		return fmt.Errorf("failed to finish %s: %w", f.path, err)
+	}
+	if f.tempPath != f.path {
+		if err := os.Rename(f.tempPath, f.path); err != nil {
+			os.Remove(f.tempPath)
+			return fmt.Errorf("failed to move %s into place: %w", f.path, err)
+		}
+	}
+	log.Printf("[%s] Wrote %d record(s) to %s", n.Name(), f.records, f.path)
+	return nil
+}
+
+// discard closes the current file and removes it.
+func (n *ExportFileNode) discard() error {
+	f := n.current
+	n.current = nil
+	f.file.Close()
+	return os.Remove(f.tempPath)
+}
+
+// writeRecord appends one encoded record.
+func (f *exportFile) writeRecord(data []byte, format string) error {
+	prefix, suffix := "", "\n"
+	if format == "json" {
+		// Array elements are separated by ",\n"; close adds the closing bracket.
+		prefix, suffix = ",\n", ""
+		if f.records == 0 {
+			prefix = "\n"
+		}
+	}
+	if _, err := f.buf.WriteString(prefix); err != nil {
+		return err
+	}
+	if _, err := f.buf.Write(data); err != nil {
+		return err
+	}
+	if _, err := f.buf.WriteString(suffix); err != nil {
+		return err
+	}
+	f.bytes += int64(len(prefix) + len(data) + len(suffix))
+	f.records++
+	return nil
+}
+
+// close terminates the file's content, flushes all layers and syncs it to disk.
+func (f *exportFile) close(format string) error {
+	err := func() error {
+		if format == "json" {
+			if _, err := f.buf.WriteString("\n]\n"); err != nil {
+				return err
+			}
+		}
+		if err := f.buf.Flush(); err != nil {
+			return err
+		}
+		if f.gzip != nil {
+			if err := f.gzip.Close(); err != nil {
+				return err
+			}
+		}
+		return f.file.Sync()
+	}()
+	if closeErr := f.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
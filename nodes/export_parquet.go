@@ -0,0 +1,291 @@
+package nodes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"data-pipeline/helpers"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+func init() {
+	Register("exportParquet", NewExportParquetNode)
+}
+
+// ExportParquetNodeConfig holds configuration for the Parquet export node.
+type ExportParquetNodeConfig struct {
+	DestinationFile string          `mapstructure:"destinationFile"` // Path template, see ExportFileNode
+	Schema          []*parquetField `mapstructure:"schema"`          // Columns; inferred from the first batch if not set
+	Compression     string          `mapstructure:"compression"`     // snappy (default), zstd, gzip or none
+	RowGroupSize    int64           `mapstructure:"rowGroupSize"`    // Target row group size in bytes (default 128MB)
+	UnknownFields   string          `mapstructure:"unknownFields"`   // warn (default) or fail on fields not in the schema
+}
+
+// ExportParquetNode writes records to a Parquet file and passes them through
+// unchanged.
+//
+// # Pipeline configuration example
+//
+//	pipelines:
+//	  log_aggregation:
+//	    - name: "ExportDailyAggregates"
+//	      type: "exportParquet"
+//	      concurrency: 1
+//	      config:
+//	        destinationFile: "./out/{{pipeline}}/{{date}}.parquet"
+//	        compression: "zstd"   // optional: snappy | zstd | gzip | none
+//	        rowGroupSize: "64MB"  // optional, default 128MB
+//	        unknownFields: "fail" // optional: warn | fail
+//	        schema:               // optional, inferred from the first batch
+//	          - { name: "UserID", type: "string" }
+//	          - { name: "count", type: "int64" }
+//
+// Schema types are string, int64, double, boolean, timestamp, json (stored as
+// a JSON string) and struct (with nested `fields`). An inferred schema maps
+// nested maps to structs and arrays to json. A Parquet file has one schema,
+// so fields that are not in it, e.g. fields that first appear after the batch
+// the schema was inferred from, cannot be written: they are dropped with a
+// warning naming each field, or fail the export with unknownFields "fail".
+// The fields of nested maps are checked against the struct's fields and
+// named by their dotted path, e.g. "properties.email".
+// The file is written under a temporary name and renamed once it is complete.
+type ExportParquetNode struct {
+	name   string
+	config ExportParquetNodeConfig
+
+	mu        sync.Mutex
+	fields    []*parquetField
+	known     map[string]*parquetField // schema fields by dotted path, e.g. "properties.email"
+	unknown   map[string]int           // records per dropped field
+	path      string
+	tempPath  string
+	file      source.ParquetFile
+	writer    *writer.JSONWriter
+	written   int
+	streaming bool
+}
+
+// NewExportParquetNode creates a new instance of the Parquet export node.
+func NewExportParquetNode(name string, config map[string]interface{}) *ExportParquetNode {
+	nodeConfig := ExportParquetNodeConfig{
+		DestinationFile: configString(config, "destinationFile", ""),
+		Compression:     strings.ToLower(configString(config, "compression", "snappy")),
+		UnknownFields:   strings.ToLower(configString(config, "unknownFields", "warn")),
+	}
+	if raw, ok := config["schema"]; ok {
+		fields, err := parquetFieldsFromConfig(raw)
+		if err != nil {
+			log.Printf("[%s] Warning: invalid 'schema' in config (%v); inferring it from the data.", name, err)
+		}
+		nodeConfig.Schema = fields
+	}
+	rowGroupSize, err := configByteSize(config, "rowGroupSize", 128<<20)
+	if err != nil || rowGroupSize <= 0 {
+		log.Printf("[%s] Warning: invalid 'rowGroupSize' in config (%v), using 128MB.", name, config["rowGroupSize"])
+		rowGroupSize = 128 << 20
+	}
+	nodeConfig.RowGroupSize = rowGroupSize
+
+	log.Printf("[%s] Initialized. Destination file: %s (compression: %s)", name, nodeConfig.DestinationFile, nodeConfig.Compression)
+	return &ExportParquetNode{name: name, config: nodeConfig}
+}
+
+// Name returns the node's name.
+func (n *ExportParquetNode) Name() string {
+	return n.name
+}
+
+// Process appends a batch to the Parquet file and returns the items unchanged.
+func (n *ExportParquetNode) Process(ctx context.Context, items []interface{}) ([]interface{}, error) {
+	logPrefix := fmt.Sprintf("[%s]", n.Name())
+	if n.config.DestinationFile == "" {
+		return nil, fmt.Errorf("%s 'destinationFile' is not configured", logPrefix)
+	}
+	codec, err := parquetCodec(n.config.Compression)
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", logPrefix, err)
+	}
+	if n.config.UnknownFields != "warn" && n.config.UnknownFields != "fail" {
+		return nil, fmt.Errorf("%s unsupported unknownFields mode: '%s'", logPrefix, n.config.UnknownFields)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.writer == nil && len(items) > 0 {
+		if err := n.open(ctx, items, codec); err != nil {
+			return nil, fmt.Errorf("%s %w", logPrefix, err)
+		}
+	}
+	for i, item := range items {
+		record, ok := item.(map[string]interface{})
+		if !ok {
+			log.Printf("%s Warning: Skipping item %d as it's not a map[string]interface{}", logPrefix, i)
+			continue
+		}
+		if err := n.checkFields("", record); err != nil {
+			return nil, fmt.Errorf("%s %w", logPrefix, err)
+		}
+		data, err := json.Marshal(parquetRow(record, n.fields))
+		if err != nil {
+			return nil, fmt.Errorf("%s failed to encode record: %w", logPrefix, err)
+		}
+		if err := n.writer.Write(string(data)); err != nil {
+			return nil, fmt.Errorf("%s failed to write %s: %w", logPrefix, n.path, err)
+		}
+		n.written++
+	}
+	return items, nil
+}
+
+// Flush finishes the file once all batches are written. In streaming runs
+// the file stays open until the pipeline stops.
+func (n *ExportParquetNode) Flush(ctx context.Context) ([]interface{}, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.writer == nil || n.streaming {
+		return nil, nil
+	}
+	if err := n.finish(); err != nil {
+		return nil, fmt.Errorf("[%s] %w", n.Name(), err)
+	}
+	return nil, nil
+}
+
+// Close finishes the file of a streaming run, or discards a file left
+// unfinished because the pipeline failed.
+func (n *ExportParquetNode) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.writer == nil {
+		return nil
+	}
+	if n.streaming {
+		return n.finish()
+	}
+	log.Printf("[%s] Discarding unfinished %s", n.Name(), n.path)
+	n.file.Close()
+	n.writer, n.file = nil, nil
+	return os.Remove(n.tempPath)
+}
+
+// open resolves the schema and creates the writer.
+func (n *ExportParquetNode) open(ctx context.Context, items []interface{}, codec parquet.CompressionCodec) error {
+	n.fields = n.config.Schema
+	if len(n.fields) == 0 {
+		n.fields = inferParquetFields(helpers.InferSchema(items))
+	}
+	n.known = make(map[string]*parquetField)
+	var index func(prefix string, fields []*parquetField)
+	index = func(prefix string, fields []*parquetField) {
+		for _, f := range fields {
+			n.known[prefix+f.Name] = f
+			index(prefix+f.Name+".", f.Fields)
+		}
+	}
+	index("", n.fields)
+	n.unknown = make(map[string]int)
+	schemaJSON, err := parquetSchemaJSON(n.fields)
+	if err != nil {
+		return err
+	}
+
+	info, _ := RunInfoFromContext(ctx)
+	n.streaming = info.Streaming
+	n.path = expandPathTemplate(ctx, n.config.DestinationFile, time.Now(), 1)
+	n.tempPath = tempPathFor(n.path)
+	if err := os.MkdirAll(filepath.Dir(n.path), 0755); err != nil {
+		return err
+	}
+	file, err := local.NewLocalFileWriter(n.tempPath)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", n.tempPath, err)
+	}
+	pw, err := writer.NewJSONWriter(schemaJSON, file, 4)
+	if err != nil {
+		file.Close()
+		os.Remove(n.tempPath)
+		return fmt.Errorf("invalid Parquet schema: %w", err)
+	}
+	pw.CompressionType = codec
+	pw.RowGroupSize = n.config.RowGroupSize
+	n.file, n.writer, n.written = file, pw, 0
+	return nil
+}
+
+// finish writes the footer and moves the file into place.
+func (n *ExportParquetNode) finish() error {
+	stopErr := n.writer.WriteStop()
+	closeErr := n.file.Close()
+	n.writer, n.file = nil, nil
+	if stopErr == nil {
+		stopErr = closeErr
+	}
+	if stopErr != nil {
+		os.Remove(n.tempPath)
+		return fmt.Errorf("failed to finish %s: %w", n.path, stopErr)
+	}
+	if err := os.Rename(n.tempPath, n.path); err != nil {
+		os.Remove(n.tempPath)
+		return fmt.Errorf("failed to move %s into place: %w", n.path, err)
+	}
+	log.Printf("[%s] Wrote %d record(s) to %s", n.Name(), n.written, n.path)
+	for name, count := range n.unknown {
+		log.Printf("[%s] Warning: dropped field %q of %d record(s) as it is not in the schema", n.Name(), name, count)
+	}
+	return nil
+}
+
+// checkFields counts the fields of record that are not in the schema, or
+// fails on them with unknownFields "fail". Nested maps written as structs
+// are checked against the struct's fields; prefix is the dotted path of the
+// struct. Callers hold n.mu.
+func (n *ExportParquetNode) checkFields(prefix string, record map[string]interface{}) error {
+	for name, value := range record {
+		if value == nil {
+			continue
+		}
+		path := prefix + name
+		if f, ok := n.known[path]; ok {
+			if nested, isMap := value.(map[string]interface{}); isMap && f.Type == "struct" {
+				if err := n.checkFields(path+".", nested); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if n.config.UnknownFields == "fail" {
+			return fmt.Errorf("field %q is not in the schema of %s", path, n.path)
+		}
+		if n.unknown[path] == 0 {
+			log.Printf("[%s] Warning: field %q is not in the schema of %s and is dropped", n.Name(), path, n.path)
+		}
+		n.unknown[path]++
+	}
+	return nil
+}
+
+// parquetCodec maps a compression name to the Parquet codec.
+func parquetCodec(name string) (parquet.CompressionCodec, error) {
+	switch name {
+	case "", "snappy":
+		return parquet.CompressionCodec_SNAPPY, nil
+	case "zstd":
+		return parquet.CompressionCodec_ZSTD, nil
+	case "gzip":
+		return parquet.CompressionCodec_GZIP, nil
+	case "none", "uncompressed":
+		return parquet.CompressionCodec_UNCOMPRESSED, nil
+	}
+	return 0, fmt.Errorf("unsupported compression: '%s'", name)
+}
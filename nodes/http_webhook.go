@@ -0,0 +1,441 @@
+package nodes
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	Register("httpWebhookSource", NewHTTPWebhookSourceNode)
+}
+
+// Signature schemes of httpWebhookSource.
+const (
+	webhookSignatureNone    = "none"
+	webhookSignatureHMAC    = "hmac"
+	webhookSignatureHubSpot = "hubspot"
+)
+
+// hubspotMaxSkew is how old a HubSpot v3 request timestamp may be.
+const hubspotMaxSkew = 5 * time.Minute
+
+// HTTPWebhookSourceNodeConfig holds configuration for the webhook source.
+type HTTPWebhookSourceNodeConfig struct {
+	Listen          string        `mapstructure:"listen"`          // Address to listen on, e.g. ":9000"
+	Path            string        `mapstructure:"path"`            // Path webhooks are posted to (default "/")
+	Signature       string        `mapstructure:"signature"`       // none, hmac or hubspot (default hmac if a secret is set; required otherwise)
+	Secret          string        `mapstructure:"secret"`          // HMAC key; the app's client secret for hubspot
+	SignatureHeader string        `mapstructure:"signatureHeader"` // Header carrying the hmac signature (default X-Signature)
+	PublicURL       string        `mapstructure:"publicUrl"`       // URL senders call, if behind a proxy (hubspot only)
+	MaxBatchSize    int           `mapstructure:"maxBatchSize"`    // Events per micro-batch (default 500)
+	MaxWait         time.Duration `mapstructure:"maxWait"`         // How long to fill a micro-batch after its first event (default 1s)
+	MaxBodySize     int64         `mapstructure:"maxBodySize"`     // Largest accepted request body (default 1MB)
+	BufferSize      int           `mapstructure:"bufferSize"`      // Requests waiting to be emitted before 503 is returned (default 1000)
+}
+
+// HTTPWebhookSourceNode receives webhooks over HTTP and emits their events as
+// records. A request body is a JSON object (one event) or an array of objects
+// (HubSpot sends its events this way). It is a streaming source (see
+// StreamingSource) and runs until the pipeline is stopped.
+//
+// # Pipeline configuration example
+//
+//	pipelines:
+//	  hubspot_webhooks:
+//	    - name: "ReceiveHubspotEvents"
+//	      type: "httpWebhookSource"
+//	      config:
+//	        listen: ":9000"
+//	        path: "/webhooks/hubspot"
+//	        signature: "hubspot"                  // none, hmac or hubspot
+//	        secret: ${HUBSPOT_CLIENT_SECRET}
+//	        publicUrl: "https://etl.example.com/webhooks/hubspot" // optional, if behind a proxy
+//	        maxBatchSize: 500                     // optional
+//	        maxWait: "1s"                         // optional
+//
+// Unsigned webhooks are only accepted with an explicit `signature: "none"`;
+// without a secret or a signature the node does not start. Requests are only
+// accepted on path exactly; any other path gets 404.
+//
+// With signature "hmac" the header named by signatureHeader must hold the
+// HMAC-SHA256 of the body, hex (optionally prefixed with "sha256=") or base64
+// encoded. With "hubspot" requests are verified with HubSpot's v3 scheme
+// (X-HubSpot-Signature-v3 over method, URL, body and timestamp) and rejected
+// if their timestamp is more than five minutes old.
+//
+// Events are buffered and emitted in micro-batches of up to maxBatchSize
+// events, or of whatever arrived within maxWait of the first one. A request is
+// answered only after its events have run through the rest of the pipeline:
+// 200 on success, 500 if the micro-batch failed and 503 if the buffer is full
+// or the pipeline is stopping, so senders retry what was not processed
+// (at-least-once).
+type HTTPWebhookSourceNode struct {
+	name   string
+	config HTTPWebhookSourceNodeConfig
+
+	listener net.Listener // set in tests; otherwise created by Stream
+	requests chan *webhookRequest
+
+	mu     sync.Mutex
+	closed bool // no more requests are buffered
+}
+
+// webhookRequest holds the events of one request until they are emitted.
+type webhookRequest struct {
+	events []interface{}
+	done   chan error // receives the outcome of the micro-batch
+}
+
+// NewHTTPWebhookSourceNode creates a new instance of the webhook source.
+func NewHTTPWebhookSourceNode(name string, config map[string]interface{}) *HTTPWebhookSourceNode {
+	nodeConfig := HTTPWebhookSourceNodeConfig{
+		Listen:          configString(config, "listen", ""),
+		Path:            configString(config, "path", "/"),
+		Secret:          configString(config, "secret", ""),
+		SignatureHeader: configString(config, "signatureHeader", "X-Signature"),
+		PublicURL:       configString(config, "publicUrl", ""),
+		MaxBatchSize:    configInt(config, "maxBatchSize", 500),
+		BufferSize:      configInt(config, "bufferSize", 1000),
+	}
+	defaultSignature := ""
+	if nodeConfig.Secret != "" {
+		defaultSignature = webhookSignatureHMAC
+	}
+	nodeConfig.Signature = strings.ToLower(configString(config, "signature", defaultSignature))
+	if !strings.HasPrefix(nodeConfig.Path, "/") {
+		nodeConfig.Path = "/" + nodeConfig.Path
+	}
+	if nodeConfig.MaxBatchSize < 1 {
+		nodeConfig.MaxBatchSize = 500
+	}
+	if nodeConfig.BufferSize < 1 {
+		nodeConfig.BufferSize = 1000
+	}
+	maxWait, err := configDuration(config, "maxWait", time.Second)
+	if err != nil {
+		log.Printf("[%s] Warning: %v; using 1s", name, err)
+		maxWait = time.Second
+	}
+	nodeConfig.MaxWait = maxWait
+	maxBodySize, err := configByteSize(config, "maxBodySize", 1<<20)
+	if err != nil {
+		log.Printf("[%s] Warning: %v; using 1MB", name, err)
+		maxBodySize = 1 << 20
+	}
+	nodeConfig.MaxBodySize = maxBodySize
+	log.Printf("[%s] Initialized. Listen: %s, path: %s, signature: %s", name, nodeConfig.Listen, nodeConfig.Path, nodeConfig.Signature)
+	return &HTTPWebhookSourceNode{name: name, config: nodeConfig}
+}
+
+// Name returns the node's name.
+func (n *HTTPWebhookSourceNode) Name() string {
+	return n.name
+}
+
+// Streaming reports that the node is a streaming source.
+func (n *HTTPWebhookSourceNode) Streaming() bool {
+	return true
+}
+
+// Process is not supported: the webhook source must be the first node of a
+// pipeline, where the orchestrator calls Stream instead.
+func (n *HTTPWebhookSourceNode) Process(ctx context.Context, items []interface{}) ([]interface{}, error) {
+	return nil, fmt.Errorf("[%s] httpWebhookSource must be the first node of a pipeline", n.Name())
+}
+
+// Stream serves webhooks until ctx is cancelled or a micro-batch fails.
+func (n *HTTPWebhookSourceNode) Stream(ctx context.Context, emit func(ctx context.Context, items []interface{}) error) error {
+	logPrefix := fmt.Sprintf("[%s]", n.Name())
+	switch n.config.Signature {
+	case "":
+		return fmt.Errorf("%s 'secret' is not configured; set signature: %q to accept unsigned webhooks", logPrefix, webhookSignatureNone)
+	case webhookSignatureNone:
+	case webhookSignatureHMAC, webhookSignatureHubSpot:
+		if n.config.Secret == "" {
+			return fmt.Errorf("%s 'secret' must be configured for signature %q", logPrefix, n.config.Signature)
+		}
+	default:
+		return fmt.Errorf("%s unknown signature %q (want none, hmac or hubspot)", logPrefix, n.config.Signature)
+	}
+	if n.listener == nil {
+		if n.config.Listen == "" {
+			return fmt.Errorf("%s 'listen' must be configured", logPrefix)
+		}
+		ln, err := net.Listen("tcp", n.config.Listen)
+		if err != nil {
+			return fmt.Errorf("%s failed to listen: %w", logPrefix, err)
+		}
+		n.listener = ln
+	}
+	n.requests = make(chan *webhookRequest, n.config.BufferSize)
+
+	// The path is compared as is rather than registered as a ServeMux
+	// pattern, in which "{" or a method prefix would have a meaning.
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != n.config.Path {
+			http.NotFound(w, r)
+			return
+		}
+		n.handle(w, r)
+	})
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.Serve(n.listener) }()
+	log.Printf("%s Receiving webhooks on %s%s", logPrefix, n.listener.Addr(), n.config.Path)
+	defer func() {
+		// Answer everything still buffered before waiting for the handlers.
+		n.close()
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		server.Shutdown(shutdownCtx)
+		cancel()
+	}()
+
+	for {
+		batch, err := n.collect(ctx, serveErr)
+		if err != nil {
+			if ctx.Err() != nil {
+				log.Printf("%s Stopped receiving webhooks.", logPrefix)
+				return nil
+			}
+			return fmt.Errorf("%s server failed: %w", logPrefix, err)
+		}
+		var records []interface{}
+		for _, req := range batch {
+			records = append(records, req.events...)
+		}
+		err = emit(ctx, records)
+		reply := err
+		if err != nil && ctx.Err() != nil {
+			reply = errWebhookUnavailable
+		}
+		for _, req := range batch {
+			req.done <- reply
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// collect blocks for the next request, then gathers further requests until
+// the batch holds maxBatchSize events or maxWait has passed. The events of a
+// request are never split across micro-batches. Requests collected when ctx
+// is cancelled are answered with 503.
+func (n *HTTPWebhookSourceNode) collect(ctx context.Context, serveErr <-chan error) ([]*webhookRequest, error) {
+	var batch []*webhookRequest
+	select {
+	case req := <-n.requests:
+		batch = append(batch, req)
+	case err := <-serveErr:
+		return nil, err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	count := len(batch[0].events)
+	timer := time.NewTimer(n.config.MaxWait)
+	defer timer.Stop()
+	for count < n.config.MaxBatchSize {
+		select {
+		case req := <-n.requests:
+			batch = append(batch, req)
+			count += len(req.events)
+		case <-timer.C:
+			return batch, nil
+		case <-ctx.Done():
+			for _, req := range batch {
+				req.done <- errWebhookUnavailable
+			}
+			return nil, ctx.Err()
+		}
+	}
+	return batch, nil
+}
+
+// close stops buffering requests and answers the buffered ones with 503.
+func (n *HTTPWebhookSourceNode) close() {
+	n.mu.Lock()
+	n.closed = true
+	n.mu.Unlock()
+	for {
+		select {
+		case req := <-n.requests:
+			req.done <- errWebhookUnavailable
+		default:
+			return
+		}
+	}
+}
+
+// errWebhookUnavailable answers requests that were not processed because the
+// pipeline is stopping or busy.
+var errWebhookUnavailable = errors.New("webhook source is not accepting events")
+
+// handle verifies and buffers one webhook request, and answers it once its
+// events have been processed.
+func (n *HTTPWebhookSourceNode) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, n.config.MaxBodySize))
+	if err != nil {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err := n.verify(r, body); err != nil {
+		log.Printf("[%s] Warning: Rejected webhook from %s: %v", n.Name(), r.RemoteAddr, err)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	events, err := decodeWebhookEvents(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(events) == 0 {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	req := &webhookRequest{events: events, done: make(chan error, 1)}
+	n.mu.Lock()
+	buffered := false
+	if !n.closed {
+		select {
+		case n.requests <- req:
+			buffered = true
+		default:
+		}
+	}
+	n.mu.Unlock()
+	if !buffered {
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, errWebhookUnavailable.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	// The request is answered even if the sender gave up, so the source
+	// never blocks on it.
+	switch err := <-req.done; {
+	case err == nil:
+		w.WriteHeader(http.StatusOK)
+	case errors.Is(err, errWebhookUnavailable):
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		http.Error(w, "failed to process events", http.StatusInternalServerError)
+	}
+}
+
+// decodeWebhookEvents parses a body holding one JSON object or an array of
+// them.
+func decodeWebhookEvents(body []byte) ([]interface{}, error) {
+	trimmed := strings.TrimSpace(string(body))
+	if strings.HasPrefix(trimmed, "{") {
+		var event map[string]interface{}
+		if err := json.Unmarshal(body, &event); err != nil {
+			return nil, fmt.Errorf("invalid JSON body: %w", err)
+		}
+		return []interface{}{event}, nil
+	}
+	var list []interface{}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, errors.New("body must be a JSON object or an array of objects")
+	}
+	for i, event := range list {
+		if _, ok := event.(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("event %d is not a JSON object", i)
+		}
+	}
+	return list, nil
+}
+
+// verify checks the request's signature with the configured scheme.
+func (n *HTTPWebhookSourceNode) verify(r *http.Request, body []byte) error {
+	switch n.config.Signature {
+	case webhookSignatureHMAC:
+		return verifyHMAC(n.config.Secret, body, r.Header.Get(n.config.SignatureHeader))
+	case webhookSignatureHubSpot:
+		return n.verifyHubSpot(r, body, time.Now())
+	}
+	return nil
+}
+
+// verifyHMAC checks that signature is the HMAC-SHA256 of body, hex encoded
+// (optionally as "sha256=<hex>") or base64 encoded.
+func verifyHMAC(secret string, body []byte, signature string) error {
+	if signature == "" {
+		return errors.New("missing signature")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	expected := mac.Sum(nil)
+	signature = strings.TrimPrefix(signature, "sha256=")
+	if got, err := hex.DecodeString(signature); err == nil && hmac.Equal(got, expected) {
+		return nil
+	}
+	if got, err := base64.StdEncoding.DecodeString(signature); err == nil && hmac.Equal(got, expected) {
+		return nil
+	}
+	return errors.New("signature mismatch")
+}
+
+// hubspotURIDecoder undoes the URL encoding HubSpot removes before signing.
+var hubspotURIDecoder = strings.NewReplacer(
+	"%3A", ":", "%2F", "/", "%3F", "?", "%40", "@", "%21", "!", "%24", "$",
+	"%27", "'", "%28", "(", "%29", ")", "%2A", "*", "%2C", ",", "%3B", ";",
+)
+
+// verifyHubSpot checks a request with HubSpot's v3 scheme: the base64
+// HMAC-SHA256 of method + URL + body + timestamp, keyed with the app's client
+// secret.
+func (n *HTTPWebhookSourceNode) verifyHubSpot(r *http.Request, body []byte, now time.Time) error {
+	signature := r.Header.Get("X-HubSpot-Signature-v3")
+	timestamp := r.Header.Get("X-HubSpot-Request-Timestamp")
+	if signature == "" || timestamp == "" {
+		return errors.New("missing X-HubSpot-Signature-v3 or X-HubSpot-Request-Timestamp")
+	}
+	ms, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %q", timestamp)
+	}
+	if now.Sub(time.UnixMilli(ms)) > hubspotMaxSkew {
+		return errors.New("timestamp is too old")
+	}
+
+	uri := n.config.PublicURL
+	if uri == "" {
+		scheme := "https"
+		if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+			scheme = proto
+		} else if r.TLS == nil {
+			scheme = "http"
+		}
+		uri = scheme + "://" + r.Host + r.URL.Path
+	}
+	if r.URL.RawQuery != "" && !strings.Contains(uri, "?") {
+		uri += "?" + r.URL.RawQuery
+	}
+	mac := hmac.New(sha256.New, []byte(n.config.Secret))
+	mac.Write([]byte(r.Method + hubspotURIDecoder.Replace(uri) + string(body) + timestamp))
+	got, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(got, mac.Sum(nil)) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
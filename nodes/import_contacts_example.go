@@ -2,7 +2,6 @@ package nodes
 
 import (
 	"context"
-	"data-pipeline/helpers"
 	"fmt"
 	"log"
 	"time"
@@ -14,9 +13,9 @@ func init() {
 
 // ImportContactsNode - Example node that “imports” data from some API
 type ImportContactsNode struct {
+    nodeState // Node state (a JSON file at cacheFile unless the pipeline injects a store)
     name   string
     config map[string]interface{}
-    cache     *helpers.FileCache // Add cache field
 	cacheFile string             // Add cache file path fiel    
 }
 
@@ -29,19 +28,11 @@ func NewImportContactsNode(name string, config map[string]interface{}) *ImportCo
 		// Fallback to default path if not provided or empty
 		cacheFilePath = fmt.Sprintf("./cache/%s_cache.json", name)
 	}
-    
-	cache, err := helpers.NewFileCache(cacheFilePath)
-	if err != nil {
-		// Log the error but potentially continue without caching
-		// Or you might want to make this fatal depending on requirements
-		log.Printf("Warning: Could not initialize cache for node %s: %v", name, err)
-		cache = nil // Ensure cache is nil if initialization failed
-	}
 
 	return &ImportContactsNode{
+		nodeState: nodeState{stateFile: cacheFilePath},
 		name:      name,
 		config:    config,
-		cache:     cache,
 		cacheFile: cacheFilePath,
 	}}
 
@@ -56,9 +47,15 @@ func (n *ImportContactsNode) Process(ctx context.Context, items []interface{}) (
 
 
     // --- Cache Usage Example ---
+	cache, err := n.StateStore()
+	if err != nil {
+		// Log the error but continue without caching
+		log.Printf("[%s] Warning: Could not open state store: %v", n.Name(), err)
+		cache = nil
+	}
 	lastImportDate := "N/A"
-	if n.cache != nil {
-		cachedDate, found := n.cache.Get("last_import_date")
+	if cache != nil {
+		cachedDate, found, _ := cache.Get("last_import_date")
 		if found {
 			lastImportDate = cachedDate
 		}
@@ -76,9 +73,9 @@ func (n *ImportContactsNode) Process(ctx context.Context, items []interface{}) (
 
 	// --- Cache Update Example ---
 	// After successful import, update the cache
-	if n.cache != nil {
+	if cache != nil {
 		currentTime := time.Now().Format(time.RFC3339) // Use a standard time format
-		err := n.cache.Set("last_import_date", currentTime)
+		err := cache.Set("last_import_date", currentTime)
 		if err != nil {
 			log.Printf("[%s] Warning: Failed to set last_import_date in cache: %v", n.Name(), err)
 		} else {
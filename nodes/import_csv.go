@@ -0,0 +1,348 @@
+package nodes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"data-pipeline/helpers"
+)
+
+func init() {
+	Register("importCSV", NewImportCSVNode)
+}
+
+// ImportCSVNodeConfig holds configuration for the CSV import node.
+type ImportCSVNodeConfig struct {
+	SourceFile  string            `mapstructure:"sourceFile"`  // Path to the CSV file
+	Delimiter   rune              `mapstructure:"delimiter"`   // Field separator (default ",")
+	Quote       rune              `mapstructure:"quote"`       // Quote character (default '"')
+	Header      bool              `mapstructure:"header"`      // First row holds column names (default true)
+	Columns     []string          `mapstructure:"columns"`     // Column names; override the header row if set
+	SkipRows    int               `mapstructure:"skipRows"`    // Rows to skip before the header/data
+	ColumnTypes map[string]string `mapstructure:"columnTypes"` // Explicit types: string, int, float, bool, time
+	InferTypes  bool              `mapstructure:"inferTypes"`  // Infer types of columns without an explicit type from the first rows
+	RaggedRows  string            `mapstructure:"raggedRows"`  // pad (default), skip or error
+}
+
+// ImportCSVNode reads records from a CSV file. The file is read row by row so
+// memory use does not depend on the file size beyond the produced records.
+//
+// # Pipeline configuration example
+//
+//	pipelines:
+//	  partner_feed:
+//	    - name: "ImportPartnerFeed"
+//	      type: "importCSV"
+//	      config:
+//	        sourceFile: "./data/partner.csv"
+//	        delimiter: ";"          // optional, default ","
+//	        quote: "'"              // optional, default '"'
+//	        header: true            // optional, default true
+//	        columns: ["id", "name"] // optional, overrides/provides column names
+//	        columnTypes:            // optional: string | int | float | bool | time
+//	          id: "int"
+//	        inferTypes: true        // optional, infer remaining columns
+//	        raggedRows: "pad"       // pad | skip | error
+//
+// Rows with fewer fields than columns are padded with nulls and extra fields
+// are dropped ("pad"), skipped ("skip") or fail the import ("error").
+//
+// With inferTypes each column without an explicit type gets one type, chosen
+// from its values in the first rows (see csvInferSampleRows): int if all are
+// integers, float if all are numbers, then bool, time and otherwise string.
+// Numbers with a leading zero such as ZIP codes ("02134") keep the column a
+// string. Later values that do not match the column's type are kept as
+// strings.
+type ImportCSVNode struct {
+	name   string
+	config ImportCSVNodeConfig
+}
+
+// NewImportCSVNode creates a new instance of the CSV import node.
+func NewImportCSVNode(name string, config map[string]interface{}) *ImportCSVNode {
+	nodeConfig := ImportCSVNodeConfig{
+		SourceFile:  configString(config, "sourceFile", ""),
+		Delimiter:   configRune(config, "delimiter", ','),
+		Quote:       configRune(config, "quote", '"'),
+		Header:      configBool(config, "header", true),
+		Columns:     configStringSlice(config, "columns"),
+		SkipRows:    configInt(config, "skipRows", 0),
+		ColumnTypes: make(map[string]string),
+		InferTypes:  configBool(config, "inferTypes", false),
+		RaggedRows:  strings.ToLower(configString(config, "raggedRows", "pad")),
+	}
+	if types, ok := config["columnTypes"].(map[string]interface{}); ok {
+		for col, t := range types {
+			if s, ok := t.(string); ok {
+				nodeConfig.ColumnTypes[col] = strings.ToLower(s)
+			}
+		}
+	}
+
+	log.Printf("[%s] Initialized. Source file: %s", name, nodeConfig.SourceFile)
+	return &ImportCSVNode{name: name, config: nodeConfig}
+}
+
+// Name returns the node's name.
+func (n *ImportCSVNode) Name() string {
+	return n.name
+}
+
+// Process reads the configured CSV file. It ignores the input 'items' as it's
+// an import node.
+func (n *ImportCSVNode) Process(ctx context.Context, items []interface{}) ([]interface{}, error) {
+	logPrefix := fmt.Sprintf("[%s]", n.Name())
+	if n.config.SourceFile == "" {
+		return nil, fmt.Errorf("%s 'sourceFile' is not configured", logPrefix)
+	}
+	switch n.config.RaggedRows {
+	case "pad", "skip", "error":
+	default:
+		return nil, fmt.Errorf("%s unsupported raggedRows mode: '%s'", logPrefix, n.config.RaggedRows)
+	}
+	for col, typ := range n.config.ColumnTypes {
+		if _, err := convertCSVValue("", typ); err != nil {
+			return nil, fmt.Errorf("%s column %q: %w", logPrefix, col, err)
+		}
+	}
+
+	file, err := os.Open(n.config.SourceFile)
+	if err != nil {
+		return nil, fmt.Errorf("%s failed to open source file %s: %w", logPrefix, n.config.SourceFile, err)
+	}
+	defer file.Close()
+
+	reader := helpers.NewCSVReader(file, helpers.CSVOptions{Delimiter: n.config.Delimiter, Quote: n.config.Quote})
+	columns := n.config.Columns
+	var records []interface{}
+	rowNumber, ragged, mismatched := 0, 0, 0
+
+	// With inferTypes the first rows are held back until the column types
+	// have been inferred from them.
+	var types map[string]string
+	var sample [][]string
+	var sampleLines []int
+	toRecord := func(row []string, line int) error {
+		record := make(map[string]interface{}, len(columns))
+		for i, col := range columns {
+			if i >= len(row) {
+				record[col] = nil
+				continue
+			}
+			value, err := n.convert(col, row[i], types)
+			if err != nil {
+				if _, explicit := n.config.ColumnTypes[col]; explicit {
+					return fmt.Errorf("%s line %d, column %q: %w", logPrefix, line, col, err)
+				}
+				value = row[i] // does not match the inferred type
+				mismatched++
+			}
+			record[col] = value
+		}
+		records = append(records, record)
+		return nil
+	}
+	flushSample := func() error {
+		types = n.inferColumnTypes(columns, sample)
+		for i, row := range sample {
+			if err := toRecord(row, sampleLines[i]); err != nil {
+				return err
+			}
+		}
+		sample, sampleLines = nil, nil
+		return nil
+	}
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s error reading %s: %w", logPrefix, n.config.SourceFile, err)
+		}
+		rowNumber++
+		if rowNumber <= n.config.SkipRows {
+			continue
+		}
+		if n.config.Header && rowNumber == n.config.SkipRows+1 {
+			if len(columns) == 0 {
+				columns = row
+			}
+			continue
+		}
+		if len(columns) == 0 {
+			// No header and no configured columns: name them col1..colN
+			for i := range row {
+				columns = append(columns, fmt.Sprintf("col%d", i+1))
+			}
+		}
+
+		if len(row) != len(columns) {
+			ragged++
+			switch n.config.RaggedRows {
+			case "skip":
+				continue
+			case "error":
+				return nil, fmt.Errorf("%s line %d has %d fields, expected %d", logPrefix, reader.Line(), len(row), len(columns))
+			}
+		}
+
+		if n.config.InferTypes && types == nil {
+			sample = append(sample, row)
+			sampleLines = append(sampleLines, reader.Line())
+			if len(sample) < csvInferSampleRows {
+				continue
+			}
+			if err := flushSample(); err != nil {
+				return nil, err
+			}
+		} else if err := toRecord(row, reader.Line()); err != nil {
+			return nil, err
+		}
+
+		if len(records)%1000 == 0 && ctx.Err() != nil {
+			log.Printf("%s Context cancelled during file read.", logPrefix)
+			return nil, ctx.Err()
+		}
+	}
+	if n.config.InferTypes && types == nil {
+		if err := flushSample(); err != nil {
+			return nil, err
+		}
+	}
+
+	if mismatched > 0 {
+		log.Printf("%s Warning: %d value(s) did not match their column's inferred type and were kept as strings", logPrefix, mismatched)
+	}
+	if ragged > 0 {
+		log.Printf("%s Warning: %d row(s) had an unexpected number of fields (mode: %s)", logPrefix, ragged, n.config.RaggedRows)
+	}
+	log.Printf("%s Successfully imported %d records from %s", logPrefix, len(records), n.config.SourceFile)
+	return records, nil
+}
+
+// csvInferSampleRows is the number of rows column types are inferred from.
+const csvInferSampleRows = 1000
+
+// convert applies the explicit or inferred type for a column.
+func (n *ImportCSVNode) convert(column, value string, inferred map[string]string) (interface{}, error) {
+	if typ, ok := n.config.ColumnTypes[column]; ok {
+		return convertCSVValue(value, typ)
+	}
+	if typ, ok := inferred[column]; ok {
+		if strings.TrimSpace(value) == "" {
+			return nil, nil
+		}
+		if (typ == "int" || typ == "float") && !isCSVNumber(value) {
+			return nil, fmt.Errorf("invalid number %q", value)
+		}
+		return convertCSVValue(value, typ)
+	}
+	return value, nil
+}
+
+// convertCSVValue converts a CSV field to the given type. Empty fields become
+// null for all types except string.
+func convertCSVValue(value, typ string) (interface{}, error) {
+	if value == "" && typ != "string" && typ != "" {
+		return nil, nil
+	}
+	switch typ {
+	case "", "string":
+		return value, nil
+	case "int":
+		return strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	case "float":
+		return strconv.ParseFloat(strings.TrimSpace(value), 64)
+	case "bool":
+		return strconv.ParseBool(strings.TrimSpace(value))
+	case "time":
+		if t, ok := helpers.ParseTime(value); ok {
+			return t, nil
+		}
+		return nil, fmt.Errorf("invalid time %q", value)
+	}
+	return nil, fmt.Errorf("unsupported column type %q", typ)
+}
+
+// inferColumnTypes picks one type per column without an explicit type from
+// the sampled rows: int, float, bool or time if every non-empty value has
+// that type, and string otherwise. Columns that are empty in every sampled row
+// are strings.
+func (n *ImportCSVNode) inferColumnTypes(columns []string, sample [][]string) map[string]string {
+	types := make(map[string]string, len(columns))
+	for i, col := range columns {
+		if _, explicit := n.config.ColumnTypes[col]; explicit {
+			continue
+		}
+		integer, number, boolean, timestamp, seen := true, true, true, true, false
+		for _, row := range sample {
+			if i >= len(row) {
+				continue
+			}
+			value := strings.TrimSpace(row[i])
+			if value == "" {
+				continue
+			}
+			seen = true
+			number = number && isCSVNumber(value)
+			integer = integer && number && isCSVInt(value)
+			boolean = boolean && (strings.EqualFold(value, "true") || strings.EqualFold(value, "false"))
+			timestamp = timestamp && isCSVTime(value)
+		}
+		switch {
+		case !seen:
+			types[col] = "string"
+		case integer:
+			types[col] = "int"
+		case number:
+			types[col] = "float"
+		case boolean:
+			types[col] = "bool"
+		case timestamp:
+			types[col] = "time"
+		default:
+			types[col] = "string"
+		}
+	}
+	return types
+}
+
+// isCSVNumber reports whether a field is a plain decimal number. Numbers
+// with a leading zero ("02134") are identifiers rather than quantities, and
+// the words ParseFloat accepts ("inf", "nan") are not numbers here.
+func isCSVNumber(value string) bool {
+	digits := strings.TrimLeft(strings.TrimSpace(value), "+-")
+	if digits == "" || (digits[0] < '0' || digits[0] > '9') && digits[0] != '.' {
+		return false
+	}
+	if len(digits) > 1 && digits[0] == '0' && digits[1] != '.' && digits[1] != 'e' && digits[1] != 'E' {
+		return false
+	}
+	_, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	return err == nil
+}
+
+// isCSVInt reports whether a number fits an int64 without a fraction or an
+// exponent.
+func isCSVInt(value string) bool {
+	_, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	return err == nil
+}
+
+// isCSVTime reports whether a field is a timestamp or a date.
+func isCSVTime(value string) bool {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02"} {
+		if _, err := time.Parse(layout, value); err == nil {
+			return true
+		}
+	}
+	return false
+}
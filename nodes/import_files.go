@@ -0,0 +1,340 @@
+package nodes
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"data-pipeline/helpers"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func init() {
+	Register("importFiles", NewImportFilesNode)
+}
+
+// ImportFilesNodeConfig holds configuration for the multi-file import node.
+type ImportFilesNodeConfig struct {
+	Paths         []string `mapstructure:"paths"`         // Glob patterns, e.g. "./logs/events-*.log.gz"
+	Compression   string   `mapstructure:"compression"`   // auto (default, by extension), gzip, zstd or none
+	CacheFilePath string   `mapstructure:"cacheFilePath"` // Where processed offsets are stored
+
+	// Follow mode (see Stream)
+	Follow       bool          `mapstructure:"follow"`       // Keep files open and emit appended lines
+	PollInterval time.Duration `mapstructure:"pollInterval"` // How often to check for new lines (default 1s)
+	MaxBatchSize int           `mapstructure:"maxBatchSize"` // Max records per micro-batch (default 1000)
+}
+
+// ImportFilesNode reads JSON Lines records from every file matching a set of
+// glob patterns. Gzip (.gz) and zstd (.zst, .zstd) files are decompressed
+// transparently. The node remembers how far it got in each file, so the next
+// run only reads new files and bytes appended since the last run. Each record
+// is annotated with `_sourceFile` and `_lineNumber`.
+//
+// # Pipeline configuration example
+//
+//	pipelines:
+//	  log_aggregation:
+//	    - name: "ImportEventLogs"
+//	      type: "importFiles"
+//	      config:
+//	        paths: ["./logs/events-*.log.gz", "./logs/events.log"]
+//	        compression: "auto"                           // optional: auto | gzip | zstd | none
+//	        cacheFilePath: "./cache/event_logs_cache.json" // optional
+//	        follow: false                                  // optional, see Stream
+//
+// In uncompressed files a trailing line without a newline is treated as still
+// being written and is picked up by a later run once it is complete. A hash of
+// the first line is stored with each position, so a file that was replaced by
+// a new one under the same name is read from the start.
+type ImportFilesNode struct {
+	nodeState
+	name   string
+	config ImportFilesNodeConfig
+}
+
+// fileProgress is the per-file position stored in the node's state.
+type fileProgress struct {
+	Offset int64  `json:"offset"`         // decompressed bytes consumed (complete lines only)
+	Line   int    `json:"line"`           // lines consumed
+	Size   int64  `json:"size"`           // raw file size when last read
+	Head   string `json:"head,omitempty"` // hash of the first line (uncompressed files)
+}
+
+// NewImportFilesNode creates a new instance of the multi-file import node.
+func NewImportFilesNode(name string, config map[string]interface{}) *ImportFilesNode {
+	nodeConfig := ImportFilesNodeConfig{
+		Paths:         configStringSlice(config, "paths"),
+		Compression:   strings.ToLower(configString(config, "compression", "auto")),
+		CacheFilePath: configString(config, "cacheFilePath", fmt.Sprintf("./cache/%s_cache.json", name)),
+		Follow:        configBool(config, "follow", false),
+		MaxBatchSize:  configInt(config, "maxBatchSize", 1000),
+	}
+	pollInterval, err := configDuration(config, "pollInterval", time.Second)
+	if err != nil || pollInterval <= 0 {
+		log.Printf("[%s] Warning: invalid 'pollInterval' in config (%v), using 1s.", name, config["pollInterval"])
+		pollInterval = time.Second
+	}
+	nodeConfig.PollInterval = pollInterval
+	if nodeConfig.MaxBatchSize < 1 {
+		nodeConfig.MaxBatchSize = 1000
+	}
+
+	log.Printf("[%s] Initialized. Paths: %v, follow: %v", name, nodeConfig.Paths, nodeConfig.Follow)
+	return &ImportFilesNode{nodeState: nodeState{stateFile: nodeConfig.CacheFilePath}, name: name, config: nodeConfig}
+}
+
+// Name returns the node's name.
+func (n *ImportFilesNode) Name() string {
+	return n.name
+}
+
+// Process reads new records from all matching files. It ignores the input
+// 'items' as it's an import node.
+func (n *ImportFilesNode) Process(ctx context.Context, items []interface{}) ([]interface{}, error) {
+	logPrefix := fmt.Sprintf("[%s]", n.Name())
+	files, err := n.matchFiles()
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", logPrefix, err)
+	}
+	state, err := n.StateStore()
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", logPrefix, err)
+	}
+
+	var records []interface{}
+	updates := make(map[string]string)
+	for _, path := range files {
+		progress := n.progress(path)
+		fileRecords, next, err := n.readFile(ctx, path, progress)
+		if err != nil {
+			return nil, fmt.Errorf("%s %w", logPrefix, err)
+		}
+		if next != progress {
+			encoded, _ := json.Marshal(next)
+			updates[progressKey(path)] = string(encoded)
+		}
+		if len(fileRecords) > 0 {
+			log.Printf("%s Read %d records from %s (lines %d-%d)", logPrefix, len(fileRecords), path, progress.Line+1, next.Line)
+		}
+		records = append(records, fileRecords...)
+	}
+
+	if err := helpers.ApplyState(state, updates, nil); err != nil {
+		log.Printf("%s Warning: failed to store file positions: %v", logPrefix, err)
+	}
+
+	log.Printf("%s Imported %d records from %d file(s)", logPrefix, len(records), len(files))
+	return records, nil
+}
+
+// matchFiles expands the configured glob patterns into a sorted, de-duplicated
+// list of regular files.
+func (n *ImportFilesNode) matchFiles() ([]string, error) {
+	if len(n.config.Paths) == 0 {
+		return nil, fmt.Errorf("'paths' is not configured")
+	}
+	seen := make(map[string]bool)
+	var files []string
+	for _, pattern := range n.config.Paths {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob pattern %q: %w", pattern, err)
+		}
+		for _, m := range matches {
+			if info, err := os.Stat(m); err != nil || !info.Mode().IsRegular() || seen[m] {
+				continue
+			}
+			seen[m] = true
+			files = append(files, m)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// progress returns the stored position for path, or the start of the file.
+func (n *ImportFilesNode) progress(path string) fileProgress {
+	var p fileProgress
+	state, err := n.StateStore()
+	if err != nil {
+		log.Printf("[%s] Warning: no stored position for %s: %v", n.Name(), path, err)
+		return p
+	}
+	raw, ok, err := state.Get(progressKey(path))
+	if err != nil {
+		log.Printf("[%s] Warning: failed to read stored position for %s: %v", n.Name(), path, err)
+		return p
+	}
+	if ok {
+		if err := json.Unmarshal([]byte(raw), &p); err != nil {
+			log.Printf("[%s] Warning: invalid stored progress for %s: %v", n.Name(), path, err)
+			return fileProgress{}
+		}
+	}
+	return p
+}
+
+// readFile reads the records after the stored position and returns them with
+// the new position.
+func (n *ImportFilesNode) readFile(ctx context.Context, path string, progress fileProgress) ([]interface{}, fileProgress, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, progress, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	switch {
+	case info.Size() == progress.Size && progress.Size > 0:
+		return nil, progress, nil // unchanged since the last run
+	case info.Size() < progress.Size:
+		log.Printf("[%s] %s shrank from %d to %d bytes; reading it from the start", n.Name(), path, progress.Size, info.Size())
+		progress = fileProgress{}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, progress, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	compression := n.compressionFor(path)
+	if compression == "none" && progress.Offset > 0 && progress.Head != "" && lineHead(file) != progress.Head {
+		log.Printf("[%s] %s was replaced since the last run; reading it from the start", n.Name(), path)
+		progress = fileProgress{}
+	}
+	reader, err := decompressingReader(file, compression)
+	if err != nil {
+		return nil, progress, fmt.Errorf("failed to open %s as %s: %w", path, compression, err)
+	}
+	defer reader.Close()
+
+	// Skip what was already consumed: seek in plain files, discard decompressed
+	// bytes in compressed ones.
+	if progress.Offset > 0 {
+		if compression == "none" {
+			_, err = file.Seek(progress.Offset, io.SeekStart)
+		} else {
+			_, err = io.CopyN(io.Discard, reader, progress.Offset)
+		}
+		if err != nil {
+			return nil, progress, fmt.Errorf("failed to skip to offset %d in %s: %w", progress.Offset, path, err)
+		}
+	}
+
+	next := progress
+	var records []interface{}
+	buffered := bufio.NewReaderSize(reader, 64*1024)
+	for {
+		line, err := buffered.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, progress, fmt.Errorf("error reading %s: %w", path, err)
+		}
+		complete := err == nil || compression != "none"
+		if len(line) == 0 || !complete {
+			break
+		}
+		next.Offset += int64(len(line))
+		next.Line++
+
+		if record, ok := n.parseLine(path, next.Line, line); ok {
+			records = append(records, record)
+		}
+		if err == io.EOF {
+			break
+		}
+		if next.Line%1000 == 0 && ctx.Err() != nil {
+			return nil, progress, ctx.Err()
+		}
+	}
+	next.Size = info.Size()
+	if compression == "none" && next.Head == "" && next.Offset > 0 {
+		next.Head = lineHead(file)
+	}
+	return records, next, nil
+}
+
+// parseLine decodes one JSON line and annotates it with its origin.
+func (n *ImportFilesNode) parseLine(path string, lineNumber int, line []byte) (map[string]interface{}, bool) {
+	trimmed := strings.TrimSpace(string(line))
+	if trimmed == "" {
+		return nil, false
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(trimmed), &record); err != nil {
+		log.Printf("[%s] Warning: Skipping %s line %d due to JSON parsing error: %v", n.Name(), path, lineNumber, err)
+		return nil, false
+	}
+	record["_sourceFile"] = path
+	record["_lineNumber"] = lineNumber
+	return record, true
+}
+
+// compressionFor resolves the compression of a file from config or extension.
+func (n *ImportFilesNode) compressionFor(path string) string {
+	if n.config.Compression != "auto" && n.config.Compression != "" {
+		return n.config.Compression
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gz", ".gzip":
+		return "gzip"
+	case ".zst", ".zstd":
+		return "zstd"
+	}
+	return "none"
+}
+
+// decompressingReader wraps r in a decompressor for the given compression.
+func decompressingReader(r io.Reader, compression string) (io.ReadCloser, error) {
+	switch compression {
+	case "none":
+		return io.NopCloser(r), nil
+	case "gzip":
+		return gzip.NewReader(r)
+	case "zstd":
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("unsupported compression %q", compression)
+}
+
+// progressKey is the state key holding the position in a file.
+func progressKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return "file:" + path
+}
+
+// lineHead returns a hash identifying a file by its first line (at most 4 KiB
+// of it), or "" if the file has no complete first line yet.
+func lineHead(r io.ReaderAt) string {
+	buf := make([]byte, 4096)
+	n, err := r.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return ""
+	}
+	buf = buf[:n]
+	if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+		buf = buf[:i+1]
+	} else if n < len(buf) {
+		return ""
+	}
+	h := fnv.New64a()
+	h.Write(buf)
+	return strconv.FormatUint(h.Sum64(), 16)
+}
@@ -0,0 +1,283 @@
+package nodes
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"sort"
+	"time"
+
+	"data-pipeline/helpers"
+)
+
+// tailedFile is an uncompressed file kept open in follow mode.
+type tailedFile struct {
+	path     string
+	file     *os.File
+	info     os.FileInfo // identity of the open file, to detect rotation
+	reader   *bufio.Reader
+	partial  []byte       // trailing bytes of a line that is still being written
+	progress fileProgress // position after the last complete line
+}
+
+// Streaming reports whether the node runs in follow mode.
+func (n *ImportFilesNode) Streaming() bool {
+	return n.config.Follow
+}
+
+// Stream implements follow mode: matching files are kept open and lines
+// appended to them are emitted as micro-batches of at most maxBatchSize
+// records, checking for new data every pollInterval. The glob patterns are
+// re-evaluated on every poll, so files created later are picked up as well.
+//
+// Rotation is handled for both common schemes: when the file at a path is
+// replaced (rename plus recreate) the old file is read to the end before the
+// new one is read from its start, and when a file is truncated it is read from
+// the start again. Compressed files are not tailed; they are read like in a
+// regular run whenever they change.
+//
+// The position a micro-batch advanced to is recorded as soon as emit has
+// returned, and in a pipeline committed at once (see StreamingSource), so a
+// restart resumes after the last micro-batch that was fully processed.
+func (n *ImportFilesNode) Stream(ctx context.Context, emit func(ctx context.Context, items []interface{}) error) error {
+	logPrefix := fmt.Sprintf("[%s]", n.Name())
+	tails := make(map[string]*tailedFile)
+	compressed := make(map[string]fileProgress) // positions in compressed files read so far
+	defer func() {
+		for _, t := range tails {
+			t.file.Close()
+		}
+	}()
+	recorded := make(map[string]fileProgress) // positions already recorded
+
+	log.Printf("%s Following %v (poll every %v)", logPrefix, n.config.Paths, n.config.PollInterval)
+	for {
+		records, positions, err := n.poll(ctx, tails, compressed)
+		if err != nil {
+			return fmt.Errorf("%s %w", logPrefix, err)
+		}
+		if len(records) > 0 {
+			if err := emit(ctx, records); err != nil {
+				return err
+			}
+		}
+		changed := make(map[string]fileProgress)
+		for path, p := range positions {
+			if previous, ok := recorded[path]; !ok || previous != p {
+				changed[path] = p
+			}
+		}
+		if err := n.saveProgress(changed); err != nil {
+			return fmt.Errorf("%s failed to store file positions: %w", logPrefix, err)
+		}
+		maps.Copy(recorded, changed)
+
+		if len(records) >= n.config.MaxBatchSize {
+			// More data is probably waiting; read it without sleeping.
+			if ctx.Err() != nil {
+				return nil
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			log.Printf("%s Stopped following files.", logPrefix)
+			return nil
+		case <-time.After(n.config.PollInterval):
+		}
+	}
+}
+
+// poll reads up to maxBatchSize new records from the matching files and
+// returns them with the positions they advanced to. Compressed files are read
+// in full from the position recorded in compressed.
+func (n *ImportFilesNode) poll(ctx context.Context, tails map[string]*tailedFile, compressed map[string]fileProgress) ([]interface{}, map[string]fileProgress, error) {
+	files, err := n.matchFiles()
+	if err != nil {
+		return nil, nil, err
+	}
+	positions := make(map[string]fileProgress)
+	var records []interface{}
+
+	for _, path := range files {
+		if n.compressionFor(path) == "none" {
+			if _, ok := tails[path]; !ok {
+				t, err := n.openTail(path)
+				if err != nil {
+					return nil, nil, err
+				}
+				tails[path] = t
+			}
+			continue
+		}
+		progress, ok := compressed[path]
+		if !ok {
+			progress = n.progress(path)
+		}
+		fileRecords, next, err := n.readFile(ctx, path, progress)
+		if err != nil {
+			return nil, nil, err
+		}
+		compressed[path] = next
+		if next != progress {
+			positions[path] = next
+		}
+		records = append(records, fileRecords...)
+	}
+
+	paths := make([]string, 0, len(tails))
+	for path := range tails {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		t := tails[path]
+		fileRecords, gone, err := n.readTail(t, path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if gone {
+			delete(tails, path)
+		}
+		records = append(records, fileRecords...)
+		positions[path] = t.progress
+		if len(records) >= n.config.MaxBatchSize {
+			break
+		}
+	}
+	return records, positions, nil
+}
+
+// openTail opens path at its stored position.
+func (n *ImportFilesNode) openTail(path string) (*tailedFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	progress := n.progress(path)
+	switch {
+	case info.Size() < progress.Offset:
+		log.Printf("[%s] %s shrank to %d bytes since position %d; following it from the start", n.Name(), path, info.Size(), progress.Offset)
+		progress = fileProgress{}
+	case progress.Offset > 0 && progress.Head != "" && lineHead(file) != progress.Head:
+		log.Printf("[%s] %s was replaced since the last run; following it from the start", n.Name(), path)
+		progress = fileProgress{}
+	}
+	if _, err := file.Seek(progress.Offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to seek to offset %d in %s: %w", progress.Offset, path, err)
+	}
+	return &tailedFile{path: path, file: file, info: info, reader: bufio.NewReaderSize(file, 64*1024), progress: progress}, nil
+}
+
+// readTail returns the records appended to a followed file since the last
+// poll, switching to a new file if path was rotated and starting over if the
+// file was truncated. If path was deleted, the rest of the file is read, the
+// file is closed and gone is true; the caller stops following it until a file
+// appears at path again.
+func (n *ImportFilesNode) readTail(t *tailedFile, path string) (records []interface{}, gone bool, err error) {
+	current, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		records, err := n.readLines(t, 0, true)
+		log.Printf("[%s] %s was deleted after %d lines; no longer following it", n.Name(), path, t.progress.Line)
+		t.file.Close()
+		return records, true, err
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+
+	if os.SameFile(current, t.info) {
+		info, err := t.file.Stat()
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+		if info.Size() < t.progress.Offset+int64(len(t.partial)) {
+			log.Printf("[%s] %s was truncated; following it from the start", n.Name(), path)
+			if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+				return nil, false, fmt.Errorf("failed to rewind %s: %w", path, err)
+			}
+			t.reader.Reset(t.file)
+			t.partial = nil
+			t.progress = fileProgress{}
+		}
+		records, err := n.readLines(t, n.config.MaxBatchSize, false)
+		return records, false, err
+	}
+
+	// The file was rotated: drain the old file, then switch to the new one.
+	records, err = n.readLines(t, 0, true)
+	if err != nil {
+		return nil, false, err
+	}
+	log.Printf("[%s] %s was rotated after %d lines; following the new file", n.Name(), path, t.progress.Line)
+	t.file.Close()
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, false, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	*t = tailedFile{path: path, file: file, info: info, reader: bufio.NewReaderSize(file, 64*1024)}
+	more, err := n.readLines(t, n.config.MaxBatchSize, false)
+	return append(records, more...), false, err
+}
+
+// readLines reads up to max (0 = unlimited) complete lines from t. With final
+// set, a trailing line without a newline is returned too, because the file
+// will not grow any further.
+func (n *ImportFilesNode) readLines(t *tailedFile, max int, final bool) ([]interface{}, error) {
+	var records []interface{}
+	for max <= 0 || len(records) < max {
+		chunk, err := t.reader.ReadBytes('\n')
+		t.partial = append(t.partial, chunk...)
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("error reading %s: %w", t.path, err)
+		}
+		if err == io.EOF && (!final || len(t.partial) == 0) {
+			break
+		}
+		line := t.partial
+		t.partial = nil
+		t.progress.Offset += int64(len(line))
+		t.progress.Line++
+		if record, ok := n.parseLine(t.path, t.progress.Line, line); ok {
+			records = append(records, record)
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	t.progress.Size = t.progress.Offset
+	if t.progress.Head == "" && t.progress.Offset > 0 {
+		t.progress.Head = lineHead(t.file)
+	}
+	return records, nil
+}
+
+// saveProgress persists the positions of several files in one state write.
+func (n *ImportFilesNode) saveProgress(positions map[string]fileProgress) error {
+	state, err := n.StateStore()
+	if err != nil {
+		return err
+	}
+	updates := make(map[string]string, len(positions))
+	for path, p := range positions {
+		encoded, _ := json.Marshal(p)
+		updates[progressKey(path)] = string(encoded)
+	}
+	return helpers.ApplyState(state, updates, nil)
+}
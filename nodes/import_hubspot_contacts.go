@@ -2,7 +2,6 @@ package nodes
 
 import (
    "context"
-   "data-pipeline/helpers"
    "encoding/json"
    "fmt"
    "io"
@@ -10,6 +9,7 @@ import (
    "net/http"
    "net/url"
    "strconv"
+   "strings"
    "time"
 )
 
@@ -34,14 +34,16 @@ func init() {
 //         cacheFilePath: "./cache/hubspot_contacts_cache.json"  // optional
 //
 type ImportHubspotContactsNode struct {
+   nodeState
    name      string
    config    map[string]interface{}
-   cache     *helpers.FileCache
    cacheFile string
 }
 
 // NewImportHubspotContactsNode creates a new ImportHubspotContactsNode.
-// It initializes a file cache to store the last time_offset.
+// The last time_offset is kept in the node's state: the pipeline's state
+// store, or a JSON file at cacheFilePath. In a pipeline the new offset is
+// only committed once the contacts have made it through the run.
 func NewImportHubspotContactsNode(name string, config map[string]interface{}) *ImportHubspotContactsNode {
    var cacheFilePath string
    if path, ok := config["cacheFilePath"].(string); ok && path != "" {
@@ -49,19 +51,20 @@ func NewImportHubspotContactsNode(name string, config map[string]interface{}) *I
    } else {
        cacheFilePath = fmt.Sprintf("./cache/%s_cache.json", name)
    }
-   cache, err := helpers.NewFileCache(cacheFilePath)
-   if err != nil {
-       log.Printf("Warning: could not initialize cache for node %s: %v", name, err)
-       cache = nil
-   }
    return &ImportHubspotContactsNode{
+       nodeState: nodeState{stateFile: cacheFilePath},
        name:      name,
        config:    config,
-       cache:     cache,
        cacheFile: cacheFilePath,
    }
 }
 
+// TimeWatermark returns the time_offset that makes the next run fetch
+// contacts modified after t.
+func (n *ImportHubspotContactsNode) TimeWatermark(t time.Time) (string, string, error) {
+   return "time_offset", strconv.FormatInt(t.UnixMilli(), 10), nil
+}
+
 // Name returns the node's name.
 func (n *ImportHubspotContactsNode) Name() string {
    return n.name
@@ -87,10 +90,15 @@ func (n *ImportHubspotContactsNode) Process(ctx context.Context, items []interfa
    } else if v, ok := n.config["limit"].(int); ok {
        limit = v
    }
-   // Retrieve last updated timestamp from cache
+   // Retrieve last updated timestamp from the node's state
+   cache, err := n.StateStore()
+   if err != nil {
+       log.Printf("[%s] Warning: could not open state store: %v", n.name, err)
+       cache = nil
+   }
    var updatedAfter int64
-   if n.cache != nil {
-       if s, found := n.cache.Get("time_offset"); found {
+   if cache != nil {
+       if s, found, _ := cache.Get("time_offset"); found {
            if ua, err := strconv.ParseInt(s, 10, 64); err == nil {
                updatedAfter = ua
            } else {
@@ -98,6 +106,11 @@ func (n *ImportHubspotContactsNode) Process(ctx context.Context, items []interfa
            }
        }
    }
+   // A backfill reads the contacts modified in its window and leaves
+   // time_offset alone.
+   if info, _ := RunInfoFromContext(ctx); info.Window != nil {
+       return n.searchWindow(ctx, apiKey, endpoint, limit, info.Window)
+   }
    // Record current time for next run
    runTime := time.Now().UnixNano() / int64(time.Millisecond)
    // Build request URL with HubSpot CRM v3 API
@@ -143,17 +156,96 @@ func (n *ImportHubspotContactsNode) Process(ctx context.Context, items []interfa
        return nil, fmt.Errorf("failed to parse response JSON: %w", err)
    }
    // Update cache with new timestamp
-   if n.cache != nil {
-       if err := n.cache.Set("time_offset", strconv.FormatInt(runTime, 10)); err != nil {
+   if cache != nil {
+       if err := cache.Set("time_offset", strconv.FormatInt(runTime, 10)); err != nil {
            log.Printf("[%s] Warning: failed to update cache: %v", n.Name(), err)
        } else {
            log.Printf("[%s] Updated time_offset in cache to %d", n.Name(), runTime)
        }
    }
    // Convert results to []interface{}
-   output := make([]interface{}, len(result.Results))
-   for i, r := range result.Results {
-       output[i] = r
+   output := make([]interface{}, 0, len(result.Results))
+   for _, r := range result.Results {
+       output = append(output, r)
+   }
+   return output, nil
+}
+
+// hubspotSearchLimit is the most results the CRM search API returns for one
+// query; it refuses to page further.
+const hubspotSearchLimit = 10000
+
+// searchWindow fetches every contact modified within a backfill window
+// through the CRM search API (<endpoint>/search), following paging.next.after
+// until the window is covered. It fails rather than return part of the
+// window, so the backfill slice is not recorded as done.
+func (n *ImportHubspotContactsNode) searchWindow(ctx context.Context, apiKey, endpoint string, limit int, window *TimeWindow) ([]interface{}, error) {
+   searchURL := strings.TrimSuffix(endpoint, "/") + "/search"
+   filters := []map[string]interface{}{
+       {"propertyName": "lastmodifieddate", "operator": "GTE", "value": strconv.FormatInt(window.From.UnixMilli(), 10)},
+       {"propertyName": "lastmodifieddate", "operator": "LT", "value": strconv.FormatInt(window.To.UnixMilli(), 10)},
+   }
+   var output []interface{}
+   after := ""
+   for {
+       query := map[string]interface{}{
+           "filterGroups": []map[string]interface{}{{"filters": filters}},
+           "sorts":        []map[string]interface{}{{"propertyName": "lastmodifieddate", "direction": "ASCENDING"}},
+           "limit":        limit,
+       }
+       if after != "" {
+           query["after"] = after
+       }
+       payload, err := json.Marshal(query)
+       if err != nil {
+           return nil, fmt.Errorf("failed to build search request: %w", err)
+       }
+       req, err := http.NewRequestWithContext(ctx, "POST", searchURL, strings.NewReader(string(payload)))
+       if err != nil {
+           return nil, fmt.Errorf("failed to create request: %w", err)
+       }
+       req.Header.Set("Authorization", "Bearer "+apiKey)
+       req.Header.Set("Content-Type", "application/json")
+       resp, err := http.DefaultClient.Do(req)
+       if err != nil {
+           return nil, fmt.Errorf("request error: %w", err)
+       }
+       body, err := io.ReadAll(resp.Body)
+       resp.Body.Close()
+       if err != nil {
+           return nil, fmt.Errorf("failed to read response body: %w", err)
+       }
+       if resp.StatusCode != http.StatusOK {
+           return nil, fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
+       }
+       var result struct {
+           Total   int                      `json:"total"`
+           Results []map[string]interface{} `json:"results"`
+           Paging  struct {
+               Next struct {
+                   After string `json:"after"`
+               } `json:"next"`
+           } `json:"paging"`
+       }
+       if err := json.Unmarshal(body, &result); err != nil {
+           return nil, fmt.Errorf("failed to parse response JSON: %w", err)
+       }
+       if result.Total > hubspotSearchLimit {
+           return nil, fmt.Errorf("%d contacts changed in %s - %s, more than the %d the search API returns; use a smaller --chunk",
+               result.Total, window.From.Format(time.RFC3339), window.To.Format(time.RFC3339), hubspotSearchLimit)
+       }
+       for _, r := range result.Results {
+           output = append(output, r)
+       }
+       after = result.Paging.Next.After
+       if after == "" {
+           if len(output) < result.Total {
+               return nil, fmt.Errorf("search returned %d of %d contacts changed in the window", len(output), result.Total)
+           }
+           break
+       }
    }
+   log.Printf("[%s] Fetched %d HubSpot contact(s) changed in %s - %s", n.Name(), len(output),
+       window.From.Format(time.RFC3339), window.To.Format(time.RFC3339))
    return output, nil
 }
\ No newline at end of file
@@ -0,0 +1,260 @@
+package nodes
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"data-pipeline/helpers"
+)
+
+func init() {
+	Register("join", NewJoinNode)
+}
+
+// JoinNodeConfig holds configuration for the join node.
+type JoinNodeConfig struct {
+	JoinType    string                 `mapstructure:"joinType"`  // inner, left (default) or anti
+	LeftKeys    []string               `mapstructure:"leftKeys"`  // Key fields on the incoming records (dotted paths allowed)
+	RightKeys   []string               `mapstructure:"rightKeys"` // Key fields on the right side, defaults to LeftKeys
+	RightNode   string                 // right.node: earlier node whose output is the right side
+	RightSource map[string]interface{} // right.source: lookup source used as the right side
+	LeftPrefix  string                 `mapstructure:"leftPrefix"`  // Prefix for left fields that collide with right fields
+	RightPrefix string                 `mapstructure:"rightPrefix"` // Prefix for right fields that collide with left fields (default "right_")
+}
+
+// JoinNode enriches incoming records (the left side) with matching records
+// from a right side, which is either the output of an earlier node in the same
+// pipeline or a lookup source (JSONL/CSV file, Mongo collection).
+//
+// # Pipeline configuration example
+//
+//	pipelines:
+//	  enriched_events:
+//	    - name: "ImportHubspotContacts"
+//	      type: "importHubspotContacts"
+//	      config: {...}
+//	    - name: "ImportAnalyticsEvents"
+//	      type: "importAnalyticsExample"
+//	      input: "none"                      // start a new branch
+//	      config: {...}
+//	    - name: "AttachContacts"
+//	      type: "join"
+//	      config:
+//	        joinType: "left"                 // inner | left | anti
+//	        leftKeys: ["email"]
+//	        rightKeys: ["properties.email"]  // optional, defaults to leftKeys
+//	        right:
+//	          node: "ImportHubspotContacts"  // or source: {type: "jsonl", path: "./ref/contacts.jsonl"}
+//	        rightPrefix: "contact_"          // optional, default "right_"
+//
+// Inner joins emit one merged record per match, left joins additionally pass
+// unmatched records through unchanged, and anti joins emit only the records
+// without a match. Records missing a key field never match.
+type JoinNode struct {
+	name   string
+	config JoinNodeConfig
+
+	mu        sync.Mutex
+	rightData []interface{}
+	index     map[string][]map[string]interface{} // right records by join key
+}
+
+// NewJoinNode creates a new instance of the join node.
+func NewJoinNode(name string, config map[string]interface{}) *JoinNode {
+	nodeConfig := JoinNodeConfig{
+		JoinType:    strings.ToLower(configString(config, "joinType", "left")),
+		LeftKeys:    configStringSlice(config, "leftKeys"),
+		RightKeys:   configStringSlice(config, "rightKeys"),
+		LeftPrefix:  configString(config, "leftPrefix", ""),
+		RightPrefix: configString(config, "rightPrefix", "right_"),
+	}
+	if on := configStringSlice(config, "on"); len(nodeConfig.LeftKeys) == 0 {
+		nodeConfig.LeftKeys = on
+	}
+	if len(nodeConfig.RightKeys) == 0 {
+		nodeConfig.RightKeys = nodeConfig.LeftKeys
+	}
+	if right, ok := config["right"].(map[string]interface{}); ok {
+		nodeConfig.RightNode = configString(right, "node", "")
+		nodeConfig.RightSource, _ = right["source"].(map[string]interface{})
+	}
+
+	log.Printf("[%s] Initialized. %s join on %v = %v", name, nodeConfig.JoinType, nodeConfig.LeftKeys, nodeConfig.RightKeys)
+
+	return &JoinNode{
+		name:   name,
+		config: nodeConfig,
+	}
+}
+
+// Name returns the node's name.
+func (n *JoinNode) Name() string {
+	return n.name
+}
+
+// UpstreamNodes returns the earlier node used as the right side, if any.
+func (n *JoinNode) UpstreamNodes() []string {
+	if n.config.RightNode == "" {
+		return nil
+	}
+	return []string{n.config.RightNode}
+}
+
+// SetUpstream receives the output of the right-side node.
+func (n *JoinNode) SetUpstream(name string, items []interface{}) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.rightData = items
+	n.index = nil
+}
+
+// Process joins a batch of left records against the right side.
+func (n *JoinNode) Process(ctx context.Context, items []interface{}) ([]interface{}, error) {
+	logPrefix := fmt.Sprintf("[%s]", n.Name())
+	if err := n.validate(); err != nil {
+		return nil, fmt.Errorf("%s %w", logPrefix, err)
+	}
+	index, err := n.rightIndex(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s failed to load right side: %w", logPrefix, err)
+	}
+
+	var output []interface{}
+	matched := 0
+	for i, item := range items {
+		left, ok := item.(map[string]interface{})
+		if !ok {
+			log.Printf("%s Warning: Skipping item %d as it's not a map[string]interface{}", logPrefix, i)
+			continue
+		}
+		var matches []map[string]interface{}
+		if key, ok := joinKey(left, n.config.LeftKeys); ok {
+			matches = index[key]
+		}
+		if len(matches) > 0 {
+			matched++
+		}
+
+		switch n.config.JoinType {
+		case "anti":
+			if len(matches) == 0 {
+				output = append(output, left)
+			}
+		case "left":
+			if len(matches) == 0 {
+				output = append(output, left)
+			}
+			fallthrough
+		case "inner":
+			for _, right := range matches {
+				output = append(output, n.merge(left, right))
+			}
+		}
+	}
+
+	log.Printf("%s Joined %d items (%d matched) -> %d items.", logPrefix, len(items), matched, len(output))
+	return output, nil
+}
+
+// validate checks the configuration before the first batch is joined.
+func (n *JoinNode) validate() error {
+	switch n.config.JoinType {
+	case "inner", "left", "anti":
+	default:
+		return fmt.Errorf("unsupported join type: '%s'", n.config.JoinType)
+	}
+	if len(n.config.LeftKeys) == 0 {
+		return fmt.Errorf("'leftKeys' (or 'on') is not configured")
+	}
+	if len(n.config.LeftKeys) != len(n.config.RightKeys) {
+		return fmt.Errorf("leftKeys and rightKeys must have the same length")
+	}
+	if n.config.RightNode == "" && n.config.RightSource == nil {
+		return fmt.Errorf("either right.node or right.source must be configured")
+	}
+	return nil
+}
+
+// rightIndex builds the key index over the right side on first use. A lookup
+// source is loaded at that point.
+func (n *JoinNode) rightIndex(ctx context.Context) (map[string][]map[string]interface{}, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.index != nil {
+		return n.index, nil
+	}
+
+	if n.config.RightNode == "" {
+		records, err := loadLookupSource(ctx, n.config.RightSource)
+		if err != nil {
+			return nil, err
+		}
+		n.rightData = records
+	}
+
+	index := make(map[string][]map[string]interface{})
+	for _, item := range n.rightData {
+		right, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if key, ok := joinKey(right, n.config.RightKeys); ok {
+			index[key] = append(index[key], right)
+		}
+	}
+	log.Printf("[%s] Indexed %d right-side records under %d keys.", n.Name(), len(n.rightData), len(index))
+	n.index = index
+	return index, nil
+}
+
+// merge combines a left and right record into a new record. Right-side key
+// fields that duplicate a left key are dropped; other colliding field names
+// are resolved with the configured prefixes.
+func (n *JoinNode) merge(left, right map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(left)+len(right))
+	for k, v := range left {
+		merged[k] = v
+	}
+	for k, v := range right {
+		if n.isSharedKey(k) {
+			continue
+		}
+		if _, collides := left[k]; collides {
+			if n.config.LeftPrefix != "" {
+				delete(merged, k)
+				merged[n.config.LeftPrefix+k] = left[k]
+			}
+			merged[n.config.RightPrefix+k] = v
+			continue
+		}
+		merged[k] = v
+	}
+	return merged
+}
+
+// isSharedKey reports whether field is a join key with the same name on both sides.
+func (n *JoinNode) isSharedKey(field string) bool {
+	for i, rk := range n.config.RightKeys {
+		if rk == field && n.config.LeftKeys[i] == field {
+			return true
+		}
+	}
+	return false
+}
+
+// joinKey builds a composite lookup key from the given fields. It returns
+// false if any key field is missing or null.
+func joinKey(record map[string]interface{}, fields []string) (string, bool) {
+	parts := make([]string, len(fields))
+	for i, f := range fields {
+		v, ok := helpers.LookupPath(record, f)
+		if !ok || v == nil {
+			return "", false
+		}
+		parts[i] = fmt.Sprint(v)
+	}
+	return strings.Join(parts, "\x1f"), true
+}
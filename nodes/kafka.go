@@ -0,0 +1,327 @@
+package nodes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"data-pipeline/helpers"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func init() {
+	Register("kafkaConsume", NewKafkaConsumeNode)
+	Register("kafkaProduce", NewKafkaProduceNode)
+}
+
+// kafkaReader is the part of *kafka.Reader used by KafkaConsumeNode.
+type kafkaReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// kafkaWriter is the part of *kafka.Writer used by KafkaProduceNode.
+type kafkaWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// KafkaConsumeNodeConfig holds configuration for the Kafka consumer node.
+type KafkaConsumeNodeConfig struct {
+	Brokers      []string      `mapstructure:"brokers"`      // e.g. ["localhost:9092"]
+	Topic        string        `mapstructure:"topic"`        // Topic to consume
+	GroupID      string        `mapstructure:"groupId"`      // Consumer group; offsets are committed for it
+	StartOffset  string        `mapstructure:"startOffset"`  // earliest (default) or latest, for groups without offsets
+	MaxBatchSize int           `mapstructure:"maxBatchSize"` // Messages per micro-batch (default 500)
+	MaxWait      time.Duration `mapstructure:"maxWait"`      // How long to fill a micro-batch after its first message (default 1s)
+}
+
+// KafkaConsumeNode consumes a topic as a member of a consumer group and emits
+// each message value, decoded as a JSON object, as a record annotated with
+// _topic, _partition, _offset and _key. It is a streaming source (see
+// StreamingSource) and runs until the pipeline is stopped.
+//
+// # Pipeline configuration example
+//
+//	pipelines:
+//	  events_ingest:
+//	    - name: "ConsumeEvents"
+//	      type: "kafkaConsume"
+//	      config:
+//	        brokers: ["localhost:9092"]
+//	        topic: "events"
+//	        groupId: "etl-events"
+//	        startOffset: "earliest" // optional
+//	        maxBatchSize: 500       // optional
+//	        maxWait: "1s"           // optional
+//
+// Offsets are committed only after a micro-batch has run through the rest of
+// the pipeline, so after a failure or restart messages are redelivered rather
+// than lost (at-least-once). Messages that are not JSON objects are skipped
+// with a warning and committed with their batch.
+type KafkaConsumeNode struct {
+	name   string
+	config KafkaConsumeNodeConfig
+	reader kafkaReader // set in tests; otherwise created by Stream
+}
+
+// NewKafkaConsumeNode creates a new instance of the Kafka consumer node.
+func NewKafkaConsumeNode(name string, config map[string]interface{}) *KafkaConsumeNode {
+	nodeConfig := KafkaConsumeNodeConfig{
+		Brokers:      configStringSlice(config, "brokers"),
+		Topic:        configString(config, "topic", ""),
+		GroupID:      configString(config, "groupId", ""),
+		StartOffset:  strings.ToLower(configString(config, "startOffset", "earliest")),
+		MaxBatchSize: configInt(config, "maxBatchSize", 500),
+	}
+	if nodeConfig.MaxBatchSize < 1 {
+		nodeConfig.MaxBatchSize = 500
+	}
+	maxWait, err := configDuration(config, "maxWait", time.Second)
+	if err != nil {
+		log.Printf("[%s] Warning: %v; using 1s", name, err)
+		maxWait = time.Second
+	}
+	nodeConfig.MaxWait = maxWait
+	log.Printf("[%s] Initialized. Topic: %s, group: %s", name, nodeConfig.Topic, nodeConfig.GroupID)
+	return &KafkaConsumeNode{name: name, config: nodeConfig}
+}
+
+// Name returns the node's name.
+func (n *KafkaConsumeNode) Name() string {
+	return n.name
+}
+
+// Streaming reports that the node is a streaming source.
+func (n *KafkaConsumeNode) Streaming() bool {
+	return true
+}
+
+// Process is not supported: the consumer must be the first node of a
+// pipeline, where the orchestrator calls Stream instead.
+func (n *KafkaConsumeNode) Process(ctx context.Context, items []interface{}) ([]interface{}, error) {
+	return nil, fmt.Errorf("[%s] kafkaConsume must be the first node of a pipeline", n.Name())
+}
+
+// Stream consumes messages until ctx is cancelled. Each micro-batch holds the
+// messages that arrive within maxWait of its first one, up to maxBatchSize.
+func (n *KafkaConsumeNode) Stream(ctx context.Context, emit func(ctx context.Context, items []interface{}) error) error {
+	logPrefix := fmt.Sprintf("[%s]", n.Name())
+	if n.reader == nil {
+		if len(n.config.Brokers) == 0 || n.config.Topic == "" || n.config.GroupID == "" {
+			return fmt.Errorf("%s 'brokers', 'topic' and 'groupId' must be configured", logPrefix)
+		}
+		startOffset := kafka.FirstOffset
+		if n.config.StartOffset == "latest" {
+			startOffset = kafka.LastOffset
+		}
+		n.reader = kafka.NewReader(kafka.ReaderConfig{
+			Brokers:     n.config.Brokers,
+			Topic:       n.config.Topic,
+			GroupID:     n.config.GroupID,
+			StartOffset: startOffset,
+		})
+	}
+	defer n.reader.Close()
+
+	for {
+		msgs, err := n.fetchBatch(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("%s failed to fetch messages: %w", logPrefix, err)
+		}
+		records := make([]interface{}, 0, len(msgs))
+		for _, msg := range msgs {
+			if record, ok := n.decode(msg); ok {
+				records = append(records, record)
+			}
+		}
+		if len(records) > 0 {
+			if err := emit(ctx, records); err != nil {
+				return err
+			}
+		}
+		// Commit even if ctx was cancelled while the batch was processed.
+		commitCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		err = n.reader.CommitMessages(commitCtx, msgs...)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("%s failed to commit offsets: %w", logPrefix, err)
+		}
+	}
+}
+
+// fetchBatch blocks for the next message, then collects further messages
+// until the batch is full or maxWait has passed.
+func (n *KafkaConsumeNode) fetchBatch(ctx context.Context) ([]kafka.Message, error) {
+	first, err := n.reader.FetchMessage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	msgs := []kafka.Message{first}
+	waitCtx, cancel := context.WithTimeout(ctx, n.config.MaxWait)
+	defer cancel()
+	for len(msgs) < n.config.MaxBatchSize {
+		msg, err := n.reader.FetchMessage(waitCtx)
+		if err != nil {
+			if waitCtx.Err() != nil && ctx.Err() == nil {
+				break // maxWait passed
+			}
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+// decode turns a message into a record annotated with its origin.
+func (n *KafkaConsumeNode) decode(msg kafka.Message) (map[string]interface{}, bool) {
+	var record map[string]interface{}
+	if err := json.Unmarshal(msg.Value, &record); err != nil || record == nil {
+		log.Printf("[%s] Warning: Skipping message %s/%d@%d as it's not a JSON object: %v", n.Name(), msg.Topic, msg.Partition, msg.Offset, err)
+		return nil, false
+	}
+	record["_topic"] = msg.Topic
+	record["_partition"] = msg.Partition
+	record["_offset"] = msg.Offset
+	if len(msg.Key) > 0 {
+		record["_key"] = string(msg.Key)
+	}
+	return record, true
+}
+
+// KafkaProduceNodeConfig holds configuration for the Kafka producer node.
+type KafkaProduceNodeConfig struct {
+	Brokers  []string `mapstructure:"brokers"`  // e.g. ["localhost:9092"]
+	Topic    string   `mapstructure:"topic"`    // Topic to write to
+	KeyField string   `mapstructure:"keyField"` // Record field used as message key (dotted paths allowed)
+	Acks     string   `mapstructure:"acks"`     // all (default), one or none
+}
+
+// KafkaProduceNode writes every record as a JSON message and passes the
+// records through. A batch returns once the broker has acknowledged all of
+// its messages.
+//
+// # Pipeline configuration example
+//
+//	pipelines:
+//	  contact_events:
+//	    - name: "PublishContacts"
+//	      type: "kafkaProduce"
+//	      batchSize: 500
+//	      config:
+//	        brokers: ["localhost:9092"]
+//	        topic: "contacts"
+//	        keyField: "id" // optional; messages with the same key go to the same partition
+//	        acks: "all"    // optional
+type KafkaProduceNode struct {
+	name   string
+	config KafkaProduceNodeConfig
+
+	mu     sync.Mutex
+	writer kafkaWriter // set in tests; otherwise created on first use
+}
+
+// NewKafkaProduceNode creates a new instance of the Kafka producer node.
+func NewKafkaProduceNode(name string, config map[string]interface{}) *KafkaProduceNode {
+	nodeConfig := KafkaProduceNodeConfig{
+		Brokers:  configStringSlice(config, "brokers"),
+		Topic:    configString(config, "topic", ""),
+		KeyField: configString(config, "keyField", ""),
+		Acks:     strings.ToLower(configString(config, "acks", "all")),
+	}
+	log.Printf("[%s] Initialized. Topic: %s", name, nodeConfig.Topic)
+	return &KafkaProduceNode{name: name, config: nodeConfig}
+}
+
+// Name returns the node's name.
+func (n *KafkaProduceNode) Name() string {
+	return n.name
+}
+
+// Process writes the batch and returns the items unchanged.
+func (n *KafkaProduceNode) Process(ctx context.Context, items []interface{}) ([]interface{}, error) {
+	logPrefix := fmt.Sprintf("[%s]", n.Name())
+	writer, err := n.open()
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", logPrefix, err)
+	}
+	msgs := make([]kafka.Message, 0, len(items))
+	for i, item := range items {
+		record, ok := item.(map[string]interface{})
+		if !ok {
+			log.Printf("%s Warning: Skipping item %d as it's not a map[string]interface{}", logPrefix, i)
+			continue
+		}
+		value, err := json.Marshal(record)
+		if err != nil {
+			return nil, fmt.Errorf("%s failed to encode item %d: %w", logPrefix, i, err)
+		}
+		msg := kafka.Message{Value: value}
+		if n.config.KeyField != "" {
+			if key, ok := helpers.LookupPath(record, n.config.KeyField); ok && key != nil {
+				msg.Key = []byte(csvField(key))
+			}
+		}
+		msgs = append(msgs, msg)
+	}
+	if len(msgs) == 0 {
+		return items, nil
+	}
+	if err := writer.WriteMessages(ctx, msgs...); err != nil {
+		return nil, fmt.Errorf("%s failed to write to %s: %w", logPrefix, n.config.Topic, err)
+	}
+	log.Printf("%s Wrote %d message(s) to %s", logPrefix, len(msgs), n.config.Topic)
+	return items, nil
+}
+
+// Close flushes and closes the writer.
+func (n *KafkaProduceNode) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.writer == nil {
+		return nil
+	}
+	err := n.writer.Close()
+	n.writer = nil
+	return err
+}
+
+// open creates the writer on first use.
+func (n *KafkaProduceNode) open() (kafkaWriter, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.writer != nil {
+		return n.writer, nil
+	}
+	if len(n.config.Brokers) == 0 || n.config.Topic == "" {
+		return nil, errors.New("'brokers' and 'topic' must be configured")
+	}
+	acks := kafka.RequireAll
+	switch n.config.Acks {
+	case "all":
+	case "one":
+		acks = kafka.RequireOne
+	case "none":
+		acks = kafka.RequireNone
+	default:
+		return nil, fmt.Errorf("unknown acks %q (want all, one or none)", n.config.Acks)
+	}
+	n.writer = &kafka.Writer{
+		Addr:         kafka.TCP(n.config.Brokers...),
+		Topic:        n.config.Topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: acks,
+		BatchTimeout: 10 * time.Millisecond, // batches are formed by the pipeline's batchSize
+	}
+	return n.writer, nil
+}
@@ -0,0 +1,147 @@
+package nodes
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"data-pipeline/helpers"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// loadLookupSource reads every record of a lookup source. Lookup sources are
+// small reference datasets loaded in full, e.g. the right side of a join.
+//
+// Supported types:
+//
+//	{type: "jsonl", path: "./ref/users.jsonl"}
+//	{type: "csv", path: "./ref/users.csv", delimiter: ","}
+//	{type: "mongo", uri: "mongodb://...", database: "db", collection: "users", filter: {...}}
+func loadLookupSource(ctx context.Context, cfg map[string]interface{}) ([]interface{}, error) {
+	sourceType := strings.ToLower(configString(cfg, "type", ""))
+	switch sourceType {
+	case "jsonl":
+		return loadJSONLFile(ctx, configString(cfg, "path", ""))
+	case "csv":
+		return loadCSVFile(configString(cfg, "path", ""), configString(cfg, "delimiter", ","))
+	case "mongo":
+		return loadMongoCollection(ctx, cfg)
+	}
+	return nil, fmt.Errorf("unsupported lookup source type: %q", sourceType)
+}
+
+// loadJSONLFile reads a JSON Lines file. Unlike the analytics importer it
+// fails on malformed lines, since a partial lookup table silently drops matches.
+func loadJSONLFile(ctx context.Context, path string) ([]interface{}, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lookup file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	var records []interface{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil, fmt.Errorf("invalid JSON on line %d of %s: %w", lineNumber, path, err)
+		}
+		records = append(records, record)
+		if lineNumber%1000 == 0 && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading lookup file %s: %w", path, err)
+	}
+	return records, nil
+}
+
+// loadCSVFile reads a CSV file with a header row. All values are strings.
+func loadCSVFile(path, delimiter string) ([]interface{}, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lookup file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	opts := helpers.CSVOptions{}
+	if delimiter != "" {
+		opts.Delimiter = []rune(delimiter)[0]
+	}
+	reader := helpers.NewCSVReader(file, opts)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header of %s: %w", path, err)
+	}
+
+	var records []interface{}
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading lookup file %s: %w", path, err)
+		}
+		record := make(map[string]interface{}, len(header))
+		for i, col := range header {
+			if i < len(row) {
+				record[col] = row[i]
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// loadMongoCollection reads the documents of a collection matching an
+// optional filter.
+func loadMongoCollection(ctx context.Context, cfg map[string]interface{}) ([]interface{}, error) {
+	database := configString(cfg, "database", "")
+	collection := configString(cfg, "collection", "")
+	if database == "" || collection == "" {
+		return nil, fmt.Errorf("mongo lookup source requires database and collection")
+	}
+	filter, err := mongoDocument(cfg["filter"])
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := connectMongo(ctx, configString(cfg, "uri", ""))
+	if err != nil {
+		return nil, err
+	}
+	defer client.Disconnect(context.Background())
+
+	cursor, err := client.Database(database).Collection(collection).Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("find on %s.%s failed: %w", database, collection, err)
+	}
+	defer cursor.Close(ctx)
+
+	var records []interface{}
+	for cursor.Next(ctx) {
+		var doc bson.D
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode document from %s.%s: %w", database, collection, err)
+		}
+		records = append(records, fromBSON(doc))
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("cursor error on %s.%s: %w", database, collection, err)
+	}
+	return records, nil
+}
@@ -0,0 +1,93 @@
+package nodes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// connectMongo opens a client for uri and verifies the connection with a ping.
+func connectMongo(ctx context.Context, uri string) (*mongo.Client, error) {
+	if uri == "" {
+		return nil, fmt.Errorf("mongo uri must be provided")
+	}
+	client, err := mongo.Connect(options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB at %s: %w", uri, err)
+	}
+	pingCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := client.Ping(pingCtx, nil); err != nil {
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("failed to ping MongoDB at %s: %w", uri, err)
+	}
+	return client, nil
+}
+
+// mongoDocument converts a config value (a map from YAML or a JSON string in
+// MongoDB extended JSON) into a BSON document usable as filter, projection or
+// sort. A nil value yields an empty document.
+func mongoDocument(v interface{}) (interface{}, error) {
+	switch d := v.(type) {
+	case nil:
+		return bson.D{}, nil
+	case string:
+		if d == "" {
+			return bson.D{}, nil
+		}
+		var doc bson.D
+		if err := bson.UnmarshalExtJSON([]byte(d), false, &doc); err != nil {
+			return nil, fmt.Errorf("invalid extended JSON %q: %w", d, err)
+		}
+		return doc, nil
+	case map[string]interface{}:
+		// Round-trip through extended JSON so operators such as {"$date": ...} work.
+		raw, err := json.Marshal(d)
+		if err != nil {
+			return nil, err
+		}
+		var doc bson.D
+		if err := bson.UnmarshalExtJSON(raw, false, &doc); err != nil {
+			return nil, fmt.Errorf("invalid mongo document %v: %w", d, err)
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("unsupported mongo document type %T", v)
+}
+
+// fromBSON converts decoded BSON values into the plain Go types used by
+// pipeline records (map[string]interface{}, []interface{}, time.Time, ...).
+func fromBSON(v interface{}) interface{} {
+	switch t := v.(type) {
+	case bson.D:
+		m := make(map[string]interface{}, len(t))
+		for _, e := range t {
+			m[e.Key] = fromBSON(e.Value)
+		}
+		return m
+	case bson.M:
+		m := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			m[k] = fromBSON(e)
+		}
+		return m
+	case bson.A:
+		a := make([]interface{}, len(t))
+		for i, e := range t {
+			a[i] = fromBSON(e)
+		}
+		return a
+	case bson.ObjectID:
+		return t.Hex()
+	case bson.DateTime:
+		return t.Time().UTC()
+	case bson.Decimal128:
+		return t.String()
+	}
+	return v
+}
@@ -0,0 +1,312 @@
+package nodes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+func init() {
+	Register("mongoImport", NewMongoImportNode)
+}
+
+// MongoImportNodeConfig holds configuration for the MongoDB source node.
+type MongoImportNodeConfig struct {
+	URI            string        `mapstructure:"uri"`            // e.g. "mongodb://localhost:27017"
+	Database       string        `mapstructure:"database"`       // e.g. "crm"
+	Collection     string        `mapstructure:"collection"`     // e.g. "contacts"
+	Mode           string        `mapstructure:"mode"`           // find (default) or changeStream
+	Filter         interface{}   `mapstructure:"filter"`         // find: query filter
+	Projection     interface{}   `mapstructure:"projection"`     // find: fields to return
+	Sort           interface{}   `mapstructure:"sort"`           // find: sort order
+	Limit          int64         `mapstructure:"limit"`          // find: maximum number of documents (0 = all)
+	MaxBatchSize   int           `mapstructure:"maxBatchSize"`   // changeStream: events per micro-batch (default 1000)
+	MaxAwaitTime   time.Duration `mapstructure:"maxAwaitTime"`   // changeStream: how long the server waits for new events (default 1s)
+	OperationField string        `mapstructure:"operationField"` // changeStream: field receiving the operation type (optional)
+	CacheFilePath  string        `mapstructure:"cacheFilePath"`  // changeStream: where the resume token is stored
+}
+
+// MongoImportNode reads documents from a MongoDB collection, either once with
+// a find query or continuously from the collection's change stream.
+// Documents are converted into map[string]interface{} records; ObjectIDs
+// become hex strings and dates time.Time values.
+//
+// # Pipeline configuration example
+//
+//	pipelines:
+//	  contacts_copy:
+//	    - name: "ActiveContacts"
+//	      type: "mongoImport"
+//	      config:
+//	        uri: "mongodb://localhost:27017"
+//	        database: "crm"
+//	        collection: "contacts"
+//	        filter: {status: "active"}     // optional; a map or extended JSON string
+//	        projection: {email: 1, name: 1} // optional
+//	        sort: {updatedAt: 1}            // optional
+//	        limit: 10000                    // optional
+//	  contacts_sync:
+//	    - name: "ContactChanges"
+//	      type: "mongoImport"
+//	      config:
+//	        uri: "mongodb://localhost:27017"
+//	        database: "crm"
+//	        collection: "contacts"
+//	        mode: "changeStream"
+//	        operationField: "_op"  // optional: adds "insert", "update" or "replace"
+//	        maxBatchSize: 500      // optional
+//	        cacheFilePath: "./cache/contact_changes_cache.json" // optional
+//
+// In changeStream mode the node is a streaming source (see StreamingSource):
+// inserted, updated and replaced documents are emitted as micro-batches in
+// their current, full form. After every micro-batch has run through the
+// pipeline, the change stream's resume token is stored in the node's state,
+// so a restart continues after the last processed change. Without a stored
+// token the stream starts at the current time. Change streams need a replica
+// set or sharded cluster.
+type MongoImportNode struct {
+	nodeState
+	name   string
+	config MongoImportNodeConfig
+}
+
+// mongoResumeTokenKey is the state key holding the change stream's resume token.
+const mongoResumeTokenKey = "resume_token"
+
+// NewMongoImportNode creates a new instance of the MongoDB source node.
+func NewMongoImportNode(name string, config map[string]interface{}) *MongoImportNode {
+	nodeConfig := MongoImportNodeConfig{
+		URI:            configString(config, "uri", ""),
+		Database:       configString(config, "database", ""),
+		Collection:     configString(config, "collection", ""),
+		Mode:           configString(config, "mode", "find"),
+		Filter:         config["filter"],
+		Projection:     config["projection"],
+		Sort:           config["sort"],
+		Limit:          int64(configInt(config, "limit", 0)),
+		MaxBatchSize:   configInt(config, "maxBatchSize", 1000),
+		OperationField: configString(config, "operationField", ""),
+		CacheFilePath:  configString(config, "cacheFilePath", fmt.Sprintf("./cache/%s_cache.json", name)),
+	}
+	if nodeConfig.MaxBatchSize < 1 {
+		nodeConfig.MaxBatchSize = 1000
+	}
+	maxAwait, err := configDuration(config, "maxAwaitTime", time.Second)
+	if err != nil {
+		log.Printf("[%s] Warning: %v; using 1s", name, err)
+		maxAwait = time.Second
+	}
+	nodeConfig.MaxAwaitTime = maxAwait
+	log.Printf("[%s] Initialized. Collection: %s.%s, mode: %s", name, nodeConfig.Database, nodeConfig.Collection, nodeConfig.Mode)
+	return &MongoImportNode{nodeState: nodeState{stateFile: nodeConfig.CacheFilePath}, name: name, config: nodeConfig}
+}
+
+// Name returns the node's name.
+func (n *MongoImportNode) Name() string {
+	return n.name
+}
+
+// Streaming reports whether the node follows the collection's change stream.
+func (n *MongoImportNode) Streaming() bool {
+	return n.config.Mode == "changeStream"
+}
+
+// Process runs the find query. It ignores the input 'items' as it's an import
+// node.
+func (n *MongoImportNode) Process(ctx context.Context, items []interface{}) ([]interface{}, error) {
+	logPrefix := fmt.Sprintf("[%s]", n.Name())
+	if err := n.validate(); err != nil {
+		return nil, fmt.Errorf("%s %w", logPrefix, err)
+	}
+	if n.Streaming() {
+		return nil, fmt.Errorf("%s changeStream mode must be the first node of a pipeline", logPrefix)
+	}
+	opts := options.Find()
+	for key, v := range map[string]interface{}{"projection": n.config.Projection, "sort": n.config.Sort} {
+		if v == nil {
+			continue
+		}
+		doc, err := mongoDocument(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s invalid %s: %w", logPrefix, key, err)
+		}
+		if key == "projection" {
+			opts.SetProjection(doc)
+		} else {
+			opts.SetSort(doc)
+		}
+	}
+	if n.config.Limit > 0 {
+		opts.SetLimit(n.config.Limit)
+	}
+	filter, err := mongoDocument(n.config.Filter)
+	if err != nil {
+		return nil, fmt.Errorf("%s invalid filter: %w", logPrefix, err)
+	}
+
+	client, err := connectMongo(ctx, n.config.URI)
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", logPrefix, err)
+	}
+	defer client.Disconnect(context.Background())
+
+	cursor, err := client.Database(n.config.Database).Collection(n.config.Collection).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s find on %s.%s failed: %w", logPrefix, n.config.Database, n.config.Collection, err)
+	}
+	defer cursor.Close(ctx)
+
+	var records []interface{}
+	for cursor.Next(ctx) {
+		var doc bson.D
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("%s failed to decode document: %w", logPrefix, err)
+		}
+		records = append(records, fromBSON(doc))
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("%s cursor error: %w", logPrefix, err)
+	}
+	log.Printf("%s Successfully imported %d documents from %s.%s", logPrefix, len(records), n.config.Database, n.config.Collection)
+	return records, nil
+}
+
+// Stream follows the collection's change stream until ctx is cancelled.
+func (n *MongoImportNode) Stream(ctx context.Context, emit func(ctx context.Context, items []interface{}) error) error {
+	logPrefix := fmt.Sprintf("[%s]", n.Name())
+	if err := n.validate(); err != nil {
+		return fmt.Errorf("%s %w", logPrefix, err)
+	}
+	client, err := connectMongo(ctx, n.config.URI)
+	if err != nil {
+		return fmt.Errorf("%s %w", logPrefix, err)
+	}
+	defer client.Disconnect(context.Background())
+
+	match := bson.D{{Key: "$match", Value: bson.D{{Key: "operationType", Value: bson.D{{Key: "$in", Value: bson.A{"insert", "update", "replace"}}}}}}}
+	opts := options.ChangeStream().
+		SetFullDocument(options.UpdateLookup).
+		SetMaxAwaitTime(n.config.MaxAwaitTime).
+		SetBatchSize(int32(n.config.MaxBatchSize))
+	if token, err := n.resumeToken(); err != nil {
+		return fmt.Errorf("%s %w", logPrefix, err)
+	} else if token != nil {
+		opts.SetResumeAfter(token)
+		log.Printf("%s Resuming change stream from stored token", logPrefix)
+	}
+	cs, err := client.Database(n.config.Database).Collection(n.config.Collection).Watch(ctx, mongo.Pipeline{match}, opts)
+	if err != nil {
+		return fmt.Errorf("%s failed to open change stream on %s.%s: %w", logPrefix, n.config.Database, n.config.Collection, err)
+	}
+	defer cs.Close(context.Background())
+
+	if err := n.streamChanges(ctx, cs, emit); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("%s %w", logPrefix, err)
+	}
+	return nil
+}
+
+// changeStream is the part of *mongo.ChangeStream used by streamChanges.
+type changeStream interface {
+	Next(ctx context.Context) bool
+	TryNext(ctx context.Context) bool
+	Decode(val interface{}) error
+	ResumeToken() bson.Raw
+	Err() error
+}
+
+// changeEvent is the part of a change event the node reads.
+type changeEvent struct {
+	OperationType string `bson:"operationType"`
+	FullDocument  bson.D `bson:"fullDocument"`
+}
+
+// streamChanges reads events from cs until it fails or ctx is cancelled. It
+// blocks for the first event of a micro-batch, then adds events that are
+// already available up to maxBatchSize, emits the batch and stores the
+// resume token.
+func (n *MongoImportNode) streamChanges(ctx context.Context, cs changeStream, emit func(ctx context.Context, items []interface{}) error) error {
+	for {
+		if !cs.Next(ctx) {
+			return cs.Err()
+		}
+		var batch []interface{}
+		for {
+			var event changeEvent
+			if err := cs.Decode(&event); err != nil {
+				return fmt.Errorf("failed to decode change event: %w", err)
+			}
+			// An update's full document is missing if it was deleted since.
+			if event.FullDocument != nil {
+				record := fromBSON(event.FullDocument).(map[string]interface{})
+				if n.config.OperationField != "" {
+					record[n.config.OperationField] = event.OperationType
+				}
+				batch = append(batch, record)
+			}
+			if len(batch) >= n.config.MaxBatchSize || !cs.TryNext(ctx) {
+				break
+			}
+		}
+		if err := cs.Err(); err != nil {
+			return err
+		}
+		if len(batch) > 0 {
+			if err := emit(ctx, batch); err != nil {
+				return err
+			}
+		}
+		if err := n.saveResumeToken(cs.ResumeToken()); err != nil {
+			log.Printf("[%s] Warning: failed to store resume token: %v", n.Name(), err)
+		}
+	}
+}
+
+// resumeToken returns the stored resume token, or nil if there is none.
+func (n *MongoImportNode) resumeToken() (interface{}, error) {
+	state, err := n.StateStore()
+	if err != nil {
+		return nil, err
+	}
+	raw, ok, err := state.Get(mongoResumeTokenKey)
+	if err != nil || !ok || raw == "" {
+		return nil, err
+	}
+	var token bson.D
+	if err := bson.UnmarshalExtJSON([]byte(raw), false, &token); err != nil {
+		return nil, fmt.Errorf("invalid stored resume token %q: %w", raw, err)
+	}
+	return token, nil
+}
+
+// saveResumeToken stores token in the node's state.
+func (n *MongoImportNode) saveResumeToken(token bson.Raw) error {
+	if token == nil {
+		return nil
+	}
+	state, err := n.StateStore()
+	if err != nil {
+		return err
+	}
+	data, err := bson.MarshalExtJSON(token, false, false)
+	if err != nil {
+		return err
+	}
+	return state.Set(mongoResumeTokenKey, string(data))
+}
+
+func (n *MongoImportNode) validate() error {
+	if n.config.Database == "" || n.config.Collection == "" {
+		return errors.New("'database' and 'collection' must be configured")
+	}
+	if n.config.Mode != "find" && n.config.Mode != "changeStream" {
+		return fmt.Errorf("unknown mode %q (want find or changeStream)", n.config.Mode)
+	}
+	return nil
+}
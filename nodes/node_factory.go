@@ -12,6 +12,7 @@ type PipelineNode struct {
     Type        string                 `yaml:"type"`        // e.g., importContacts, transform, exportContacts
     Concurrency int                    `yaml:"concurrency"` // number of concurrent workers
     BatchSize   int                    `yaml:"batchSize"`   // batch size for chunking
+    Input       string                 `yaml:"input"`       // optional: earlier node whose output feeds this node, or "none" to start a new branch
     Config      map[string]interface{} `yaml:"config"`      // node-specific config
 }
 
@@ -1,6 +1,11 @@
 package nodes
 
-import "context"
+import (
+    "context"
+    "time"
+
+    "data-pipeline/helpers"
+)
 
 // Node is the interface that all ETL pipeline nodes must implement.
 type Node interface {
@@ -8,3 +13,74 @@ type Node interface {
     // Process receives items from the previous node and returns new items for the next node
     Process(ctx context.Context, items []interface{}) ([]interface{}, error)
 }
+
+// Flusher is implemented by nodes that need to see every batch before they can
+// emit results (e.g. grouping or windowing nodes). The orchestrator calls Flush
+// once after the last batch has been processed and appends its output to the
+// node's output.
+type Flusher interface {
+    Flush(ctx context.Context) ([]interface{}, error)
+}
+
+// UpstreamConsumer is implemented by nodes that read the output of an earlier
+// node in the same pipeline in addition to their regular input (e.g. the right
+// side of a join). The orchestrator calls SetUpstream for every name returned
+// by UpstreamNodes before the node's first Process call.
+type UpstreamConsumer interface {
+    UpstreamNodes() []string
+    SetUpstream(name string, items []interface{})
+}
+
+// ErrorOutputNode is implemented by nodes that divert rejected records to a
+// separate error output instead of failing the batch. After the node has
+// finished, the orchestrator collects the rejected records with TakeErrors and
+// makes them available to later nodes as "<node name>:errors" (e.g. via a
+// node's `input` field).
+type ErrorOutputNode interface {
+    TakeErrors() []interface{}
+}
+
+// StreamingSource is implemented by source nodes that keep producing records
+// over time (e.g. files in follow mode). When the first node of a pipeline
+// reports Streaming() == true, the orchestrator calls Stream instead of
+// Process. Every micro-batch passed to emit runs through the remaining nodes
+// (including their Flush) before emit returns, so a source may persist its
+// position once emit has returned nil; the orchestrator commits the state a
+// source changes at once. Stream returns when ctx is cancelled or the source
+// is exhausted.
+type StreamingSource interface {
+    Streaming() bool
+    Stream(ctx context.Context, emit func(ctx context.Context, items []interface{}) error) error
+}
+
+// ConcurrencyAware is implemented by nodes that size resources (e.g. a
+// connection pool) by the number of workers that call Process at the same
+// time. The orchestrator calls SetConcurrency with the node's `concurrency`
+// setting before the first Process call.
+type ConcurrencyAware interface {
+    SetConcurrency(n int)
+}
+
+// StateAware is implemented by nodes that keep state between runs
+// (watermarks, positions, seen keys). StateStore returns the node's own
+// store, its state file, which is only opened once the store is used.
+// Before the first Process call the orchestrator calls SetStateStore with a
+// store that stages the node's changes until the run, or its commit point,
+// has succeeded; it wraps the shared state store, namespaced by pipeline and
+// node name, if config.yaml configures one. CloseState releases the state
+// file, if it was opened, once the run has ended, so the file is not locked
+// between runs. StateFile returns the path of that file, from which state is
+// imported into a newly configured shared store.
+type StateAware interface {
+    StateStore() (helpers.StateStore, error)
+    SetStateStore(store helpers.StateStore)
+    CloseState() error
+    StateFile() string
+}
+
+// TimeWatermarked is implemented by stateful nodes that read records changed
+// after a point in time. TimeWatermark returns the state key and value that
+// make the next run start at t; `data-pipeline state set --from` uses it.
+type TimeWatermarked interface {
+    TimeWatermark(t time.Time) (key, value string, err error)
+}
@@ -0,0 +1,314 @@
+package nodes
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"data-pipeline/helpers"
+
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/schema"
+)
+
+// parquetField is one column, or a struct of columns, of a Parquet schema.
+// Types: string, int64, double, boolean, timestamp (milliseconds), json (any
+// value stored as a JSON string) and struct.
+type parquetField struct {
+	Name   string
+	Type   string
+	Fields []*parquetField
+}
+
+// parquetFieldsFromConfig reads a schema from node config, e.g.
+//
+//	schema:
+//	  - { name: "userId", type: "string" }
+//	  - { name: "count", type: "int64" }
+//	  - name: "properties"
+//	    type: "struct"
+//	    fields:
+//	      - { name: "email", type: "string" }
+func parquetFieldsFromConfig(raw interface{}) ([]*parquetField, error) {
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("'schema' must be a list of fields")
+	}
+	var fields []*parquetField
+	for i, entry := range list {
+		m, ok := entry.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("schema field %d is not a mapping", i+1)
+		}
+		f := &parquetField{Name: configString(m, "name", ""), Type: strings.ToLower(configString(m, "type", "string"))}
+		if f.Name == "" {
+			return nil, fmt.Errorf("schema field %d has no name", i+1)
+		}
+		switch f.Type {
+		case "string", "int64", "double", "boolean", "timestamp", "json":
+		case "struct":
+			children, err := parquetFieldsFromConfig(m["fields"])
+			if err != nil {
+				return nil, fmt.Errorf("field %q: %w", f.Name, err)
+			}
+			f.Fields = children
+		default:
+			return nil, fmt.Errorf("field %q has unsupported type %q", f.Name, f.Type)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// inferParquetFields derives Parquet fields from an inferred record schema.
+// Nested objects become structs, arrays and fields with mixed types are
+// stored as JSON, and mixed integer/number fields as doubles.
+func inferParquetFields(s *helpers.Schema) []*parquetField {
+	paths := make([]string, 0, len(s.Fields))
+	for path := range s.Fields {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	root := &parquetField{Type: "struct"}
+	structs := map[string]*parquetField{"": root}
+	for _, path := range paths {
+		parentPath, name := "", path
+		if i := strings.LastIndex(path, "."); i >= 0 {
+			parentPath, name = path[:i], path[i+1:]
+		}
+		parent, ok := structs[parentPath]
+		if !ok {
+			continue // parent is stored as JSON
+		}
+		f := &parquetField{Name: name, Type: parquetTypeFor(s.Fields[path].Types)}
+		if f.Type == "struct" {
+			structs[path] = f
+		}
+		parent.Fields = append(parent.Fields, f)
+	}
+	return root.Fields
+}
+
+// parquetTypeFor maps the observed value types of a field to a Parquet type.
+func parquetTypeFor(types []string) string {
+	switch strings.Join(types, ",") {
+	case "", "string":
+		return "string"
+	case "integer":
+		return "int64"
+	case "integer,number", "number":
+		return "double"
+	case "boolean":
+		return "boolean"
+	case "timestamp":
+		return "timestamp"
+	case "object":
+		return "struct"
+	}
+	return "json"
+}
+
+// parquetSchemaJSON renders fields as a parquet-go JSON schema. All fields are
+// optional so missing values are written as nulls.
+func parquetSchemaJSON(fields []*parquetField) (string, error) {
+	type item struct {
+		Tag    string  `json:"Tag"`
+		Fields []*item `json:"Fields,omitempty"`
+	}
+	var build func(fields []*parquetField) []*item
+	build = func(fields []*parquetField) []*item {
+		items := make([]*item, 0, len(fields))
+		for _, f := range fields {
+			tag := "name=" + f.Name + ", repetitiontype=OPTIONAL"
+			switch f.Type {
+			case "string", "json":
+				tag += ", type=BYTE_ARRAY, convertedtype=UTF8"
+			case "int64":
+				tag += ", type=INT64"
+			case "double":
+				tag += ", type=DOUBLE"
+			case "boolean":
+				tag += ", type=BOOLEAN"
+			case "timestamp":
+				tag += ", type=INT64, convertedtype=TIMESTAMP_MILLIS"
+			}
+			it := &item{Tag: tag}
+			if f.Type == "struct" {
+				it.Fields = build(f.Fields)
+			}
+			items = append(items, it)
+		}
+		return items
+	}
+	if len(fields) == 0 {
+		return "", fmt.Errorf("schema has no fields")
+	}
+	data, err := json.Marshal(&item{Tag: "name=parquet_go_root, repetitiontype=REQUIRED", Fields: build(fields)})
+	return string(data), err
+}
+
+// parquetRow converts a record into the JSON-compatible shape the schema
+// expects. Fields not in the schema are dropped and values that cannot be
+// converted become null.
+func parquetRow(record map[string]interface{}, fields []*parquetField) map[string]interface{} {
+	row := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		if v := parquetValue(record[f.Name], f); v != nil {
+			row[f.Name] = v
+		}
+	}
+	return row
+}
+
+func parquetValue(v interface{}, f *parquetField) interface{} {
+	if v == nil {
+		return nil
+	}
+	switch f.Type {
+	case "string":
+		switch t := v.(type) {
+		case string:
+			return t
+		case time.Time:
+			return t.Format(time.RFC3339Nano)
+		}
+		return csvField(v)
+	case "json":
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil
+		}
+		return string(data)
+	case "int64":
+		switch t := v.(type) {
+		case int:
+			return int64(t)
+		case int32:
+			return int64(t)
+		case int64:
+			return t
+		case float64:
+			return int64(t)
+		case string:
+			if i, err := strconv.ParseInt(strings.TrimSpace(t), 10, 64); err == nil {
+				return i
+			}
+		}
+	case "double":
+		switch t := v.(type) {
+		case int:
+			return float64(t)
+		case int64:
+			return float64(t)
+		case float64:
+			return t
+		case string:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(t), 64); err == nil {
+				return f
+			}
+		}
+	case "boolean":
+		switch t := v.(type) {
+		case bool:
+			return t
+		case string:
+			if b, err := strconv.ParseBool(strings.TrimSpace(t)); err == nil {
+				return b
+			}
+		}
+	case "timestamp":
+		if t, ok := helpers.ParseTime(v); ok {
+			return t.UnixMilli()
+		}
+	case "struct":
+		if m, ok := v.(map[string]interface{}); ok {
+			return parquetRow(m, f.Fields)
+		}
+	}
+	return nil
+}
+
+// parquetColumn mirrors a file's schema tree with the original column names,
+// used to turn the rows parquet-go reads into records.
+type parquetColumn struct {
+	name      string
+	converted *parquet.ConvertedType
+	children  []*parquetColumn
+}
+
+// parquetColumns builds the column tree from a reader's schema handler.
+func parquetColumns(sh *schema.SchemaHandler) *parquetColumn {
+	pos := 0
+	var build func() *parquetColumn
+	build = func() *parquetColumn {
+		el := sh.SchemaElements[pos]
+		col := &parquetColumn{name: sh.Infos[pos].ExName, converted: el.ConvertedType}
+		pos++
+		for i := int32(0); i < el.GetNumChildren(); i++ {
+			col.children = append(col.children, build())
+		}
+		return col
+	}
+	return build()
+}
+
+// parquetRecordValue converts a value read by parquet-go into a record value.
+func parquetRecordValue(v reflect.Value, col *parquetColumn) interface{} {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return parquetRecordValue(v.Elem(), col)
+	case reflect.Struct:
+		m := make(map[string]interface{}, len(col.children))
+		for i, child := range col.children {
+			if i < v.NumField() {
+				m[child.name] = parquetRecordValue(v.Field(i), child)
+			}
+		}
+		return m
+	case reflect.Slice:
+		element := col
+		if col.converted != nil && *col.converted == parquet.ConvertedType_LIST && len(col.children) == 1 && len(col.children[0].children) == 1 {
+			element = col.children[0].children[0]
+		}
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			out[i] = parquetRecordValue(v.Index(i), element)
+		}
+		return out
+	case reflect.Map:
+		value := col
+		if len(col.children) == 1 && len(col.children[0].children) == 2 {
+			value = col.children[0].children[1]
+		}
+		out := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out[fmt.Sprint(iter.Key().Interface())] = parquetRecordValue(iter.Value(), value)
+		}
+		return out
+	case reflect.Int32, reflect.Int64:
+		i := v.Int()
+		if col.converted != nil {
+			switch *col.converted {
+			case parquet.ConvertedType_TIMESTAMP_MILLIS:
+				return time.UnixMilli(i).UTC()
+			case parquet.ConvertedType_TIMESTAMP_MICROS:
+				return time.UnixMicro(i).UTC()
+			case parquet.ConvertedType_DATE:
+				return time.Unix(i*86400, 0).UTC()
+			}
+		}
+		return i
+	case reflect.Float32:
+		return v.Float()
+	}
+	return v.Interface()
+}
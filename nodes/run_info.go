@@ -0,0 +1,38 @@
+package nodes
+
+import (
+	"context"
+	"time"
+)
+
+// RunInfo describes the pipeline run a node is executing in. The orchestrator
+// attaches it to the context passed to Process, Flush and Stream.
+type RunInfo struct {
+	Pipeline  string      // name of the pipeline
+	RunID     string      // unique, time-ordered identifier of the run
+	Started   time.Time   // when the run started
+	Streaming bool        // the run is driven by a streaming source (Flush runs per micro-batch)
+	Window    *TimeWindow // set in backfill runs, see TimeWindow
+}
+
+// TimeWindow is the time slice of a backfill run. Sources with a time-based
+// watermark (see TimeWatermarked) read the records changed in [From, To)
+// instead of those changed since their watermark, and leave the watermark
+// alone.
+type TimeWindow struct {
+	From time.Time
+	To   time.Time
+}
+
+type runInfoKey struct{}
+
+// WithRunInfo returns a copy of ctx carrying info.
+func WithRunInfo(ctx context.Context, info RunInfo) context.Context {
+	return context.WithValue(ctx, runInfoKey{}, info)
+}
+
+// RunInfoFromContext returns the RunInfo attached to ctx, if any.
+func RunInfoFromContext(ctx context.Context) (RunInfo, bool) {
+	info, ok := ctx.Value(runInfoKey{}).(RunInfo)
+	return info, ok
+}
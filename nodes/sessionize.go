@@ -0,0 +1,222 @@
+package nodes
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"maps"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"data-pipeline/helpers"
+)
+
+func init() {
+	Register("sessionize", NewSessionizeNode)
+}
+
+// SessionizeNodeConfig holds configuration for the sessionize node.
+type SessionizeNodeConfig struct {
+	UserField      string        `mapstructure:"userField"`      // Field identifying the user (default "UserID")
+	TimestampField string        `mapstructure:"timestampField"` // Event time field (default "timestamp")
+	EventTypeField string        `mapstructure:"eventTypeField"` // Event type field (default "eventType")
+	PageField      string        `mapstructure:"pageField"`      // Page field used for entry/exit pages (default "page")
+	Gap            time.Duration `mapstructure:"gap"`            // Inactivity gap that closes a session (default 30m)
+	Emit           string        `mapstructure:"emit"`           // "sessions" (default) or "events" to emit the events as well
+	SessionIDField string        `mapstructure:"sessionIdField"` // Session ID field of session records and annotated events (default "sessionId")
+}
+
+// SessionizeNode groups events per user into sessions separated by an
+// inactivity gap. Because sessions can span batches, events are buffered in
+// Process and the sessions are emitted once all batches have been seen. In
+// streaming runs a session is emitted once it is closed, i.e. the newest event
+// seen is more than gap past its last event; sessions still open when the
+// stream stops are not emitted.
+//
+// # Pipeline configuration example
+//
+//	pipelines:
+//	  log_aggregation:
+//	    - name: "SessionizeEvents"
+//	      type: "sessionize"
+//	      config:
+//	        userField: "UserID"         // optional, default "UserID"
+//	        timestampField: "timestamp" // optional, default "timestamp"
+//	        gap: "30m"                  // optional, default 30m
+//	        emit: "sessions"            // or "events" to emit events annotated with sessionId, too
+//
+// Each session record contains sessionIdField (default sessionId), the user
+// field, start, end, durationSeconds, eventCount, eventTypes (in order),
+// entryPage and exitPage. Session records are emitted in every mode; with
+// emit "events" each is preceded by the session's events, annotated with the
+// same sessionIdField.
+type SessionizeNode struct {
+	name   string
+	config SessionizeNodeConfig
+
+	mu     sync.Mutex
+	events map[string][]sessionEvent // buffered events keyed by user
+	users  map[string]interface{}    // original user value for each key
+	latest time.Time                 // newest event time seen (streaming)
+}
+
+// sessionEvent is a buffered event together with its parsed timestamp.
+type sessionEvent struct {
+	at     time.Time
+	record map[string]interface{}
+}
+
+// NewSessionizeNode creates a new instance of the sessionize node.
+func NewSessionizeNode(name string, config map[string]interface{}) *SessionizeNode {
+	nodeConfig := SessionizeNodeConfig{
+		UserField:      configString(config, "userField", "UserID"),
+		TimestampField: configString(config, "timestampField", "timestamp"),
+		EventTypeField: configString(config, "eventTypeField", "eventType"),
+		PageField:      configString(config, "pageField", "page"),
+		Emit:           strings.ToLower(configString(config, "emit", "sessions")),
+		SessionIDField: configString(config, "sessionIdField", "sessionId"),
+	}
+	gap, err := configDuration(config, "gap", 30*time.Minute)
+	if err != nil || gap <= 0 {
+		log.Printf("[%s] Warning: invalid 'gap' in config (%v), using 30m.", name, config["gap"])
+		gap = 30 * time.Minute
+	}
+	nodeConfig.Gap = gap
+
+	log.Printf("[%s] Initialized. Grouping by '%s', gap: %v, emit: %s", name, nodeConfig.UserField, nodeConfig.Gap, nodeConfig.Emit)
+
+	return &SessionizeNode{
+		name:   name,
+		config: nodeConfig,
+		events: make(map[string][]sessionEvent),
+		users:  make(map[string]interface{}),
+	}
+}
+
+// Name returns the node's name.
+func (n *SessionizeNode) Name() string {
+	return n.name
+}
+
+// Process buffers the events of a batch. Sessions are emitted by Flush.
+func (n *SessionizeNode) Process(ctx context.Context, items []interface{}) ([]interface{}, error) {
+	logPrefix := fmt.Sprintf("[%s]", n.Name())
+	if n.config.Emit != "sessions" && n.config.Emit != "events" {
+		return nil, fmt.Errorf("%s unsupported emit mode: '%s'", logPrefix, n.config.Emit)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for i, item := range items {
+		event, ok := item.(map[string]interface{})
+		if !ok {
+			log.Printf("%s Warning: Skipping item %d as it's not a map[string]interface{}", logPrefix, i)
+			continue
+		}
+		user, ok := event[n.config.UserField]
+		if !ok || user == nil {
+			log.Printf("%s Warning: Skipping item %d as userField '%s' not found", logPrefix, i, n.config.UserField)
+			continue
+		}
+		at, ok := helpers.ParseTime(event[n.config.TimestampField])
+		if !ok {
+			log.Printf("%s Warning: Skipping item %d due to missing or invalid '%s'", logPrefix, i, n.config.TimestampField)
+			continue
+		}
+		if at.After(n.latest) {
+			n.latest = at
+		}
+		key := fmt.Sprint(user)
+		n.users[key] = user
+		n.events[key] = append(n.events[key], sessionEvent{at: at, record: event})
+	}
+	return []interface{}{}, nil
+}
+
+// Flush splits the buffered events into sessions and emits them, ordered by
+// user and session start.
+func (n *SessionizeNode) Flush(ctx context.Context) ([]interface{}, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	info, _ := RunInfoFromContext(ctx)
+
+	keys := make([]string, 0, len(n.events))
+	for k := range n.events {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var output []interface{}
+	sessionCount := 0
+	for _, key := range keys {
+		events := n.events[key]
+		sort.SliceStable(events, func(i, j int) bool { return events[i].at.Before(events[j].at) })
+
+		start := 0
+		for i := 1; i <= len(events); i++ {
+			if i < len(events) && events[i].at.Sub(events[i-1].at) <= n.config.Gap {
+				continue
+			}
+			if i == len(events) && info.Streaming && n.latest.Sub(events[i-1].at) <= n.config.Gap {
+				break // still open; kept for the next micro-batch
+			}
+			session := events[start:i]
+			sessionCount++
+			if n.config.Emit == "events" {
+				id := n.sessionID(key, session[0].at)
+				for _, e := range session {
+					// Input records may be shared with other branches.
+					record := maps.Clone(e.record)
+					record[n.config.SessionIDField] = id
+					output = append(output, record)
+				}
+			}
+			output = append(output, n.buildSession(key, session))
+			start = i
+		}
+		if start < len(events) {
+			n.events[key] = events[start:]
+		} else {
+			delete(n.events, key)
+			delete(n.users, key)
+		}
+	}
+
+	log.Printf("[%s] Built %d session(s) for %d user(s).", n.Name(), sessionCount, len(keys))
+	return output, nil
+}
+
+// buildSession summarizes a time-ordered slice of events into a session record.
+func (n *SessionizeNode) buildSession(userKey string, events []sessionEvent) map[string]interface{} {
+	first, last := events[0], events[len(events)-1]
+	eventTypes := make([]interface{}, 0, len(events))
+	var entryPage, exitPage interface{}
+	for _, e := range events {
+		eventTypes = append(eventTypes, e.record[n.config.EventTypeField])
+		if page, ok := e.record[n.config.PageField]; ok && page != nil && page != "" {
+			if entryPage == nil {
+				entryPage = page
+			}
+			exitPage = page
+		}
+	}
+	return map[string]interface{}{
+		n.config.SessionIDField: n.sessionID(userKey, first.at),
+		n.config.UserField:      n.users[userKey],
+		"start":                 first.at.UTC().Format(time.RFC3339),
+		"end":                   last.at.UTC().Format(time.RFC3339),
+		"durationSeconds":       last.at.Sub(first.at).Seconds(),
+		"eventCount":            len(events),
+		"eventTypes":            eventTypes,
+		"entryPage":             entryPage,
+		"exitPage":              exitPage,
+	}
+}
+
+// sessionID derives a deterministic session identifier from the user and the
+// session start, so re-running over the same events yields the same IDs.
+func (n *SessionizeNode) sessionID(userKey string, start time.Time) string {
+	return fmt.Sprintf("%s-%d", userKey, start.UnixMilli())
+}
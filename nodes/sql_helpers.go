@@ -0,0 +1,276 @@
+package nodes
+
+import (
+	"cmp"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"data-pipeline/helpers"
+)
+
+// The helpers below are shared by the SQL source and sink nodes.
+
+// quoteIdent quotes a table or column name for use in SQL.
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// sqlValue converts a record value into a value database/sql drivers accept:
+// timestamps become RFC3339 strings and nested values JSON text.
+func sqlValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case time.Time:
+		return t.UTC().Format(time.RFC3339Nano)
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(t)
+		if err != nil {
+			return fmt.Sprint(t)
+		}
+		return string(data)
+	}
+	return v
+}
+
+// scanRows calls fn with every row of rows as a record. Byte slices are
+// returned as strings.
+func scanRows(rows *sql.Rows, fn func(record map[string]interface{}) error) error {
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return err
+		}
+		record := make(map[string]interface{}, len(columns))
+		for i, col := range columns {
+			if b, ok := values[i].([]byte); ok {
+				record[col] = string(b)
+			} else {
+				record[col] = values[i]
+			}
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// sqlWatermark tracks the highest value of a watermark column for
+// incremental loads. Like the HubSpot node's time_offset it is kept in the
+// node's state store and only advanced after a successful read.
+type sqlWatermark struct {
+	store   helpers.StateStore
+	column  string
+	current interface{} // value bound to :watermark for this run
+	max     interface{} // highest value seen in this run
+	window  *TimeWindow // backfill window; nil outside backfills
+}
+
+// watermarkCacheKey is the state key holding the watermark.
+const watermarkCacheKey = "watermark"
+
+// newSQLWatermark loads the stored watermark, falling back to initial.
+func newSQLWatermark(store helpers.StateStore, column, initial string) (*sqlWatermark, error) {
+	w := &sqlWatermark{store: store, column: column}
+	raw, ok, err := store.Get(watermarkCacheKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read watermark: %w", err)
+	}
+	if ok {
+		v, err := decodeWatermark(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stored watermark %q: %w", raw, err)
+		}
+		w.current = v
+		return w, nil
+	}
+	if initial != "" {
+		w.current = initial
+	}
+	return w, nil
+}
+
+// backfill reads the records of a backfill window instead of those after
+// the stored watermark, which Save then leaves alone. :watermark is bound a
+// second before the window, so rows at its very start are read, in the
+// format of the stored watermark (see sqlTime); Keep drops rows outside the
+// window. Without a stored text timestamp to take the format from, a text
+// bound is just the date, which orders before every timestamp of that day.
+func (w *sqlWatermark) backfill(window *TimeWindow, driver string) {
+	bound := window.From.Add(-time.Second)
+	if _, ok := textTimeLayout(w.current); !ok && driver != "pgx" {
+		w.current = bound.UTC().Format(time.DateOnly)
+	} else {
+		w.current = sqlTime(driver, w.current)(bound)
+	}
+	w.window = window
+}
+
+// Keep reports whether a row is inside the backfill window, if any. Column
+// values are compared as times, whatever format they are stored in.
+func (w *sqlWatermark) Keep(record map[string]interface{}) bool {
+	if w.window == nil {
+		return true
+	}
+	t, ok := helpers.ParseTime(record[w.column])
+	if !ok {
+		return false
+	}
+	return !t.Before(w.window.From) && t.Before(w.window.To)
+}
+
+// Param returns the value to bind to :watermark. Before the first load,
+// without an initial value, it is the smallest integer: in SQL databases
+// that order mixed types like SQLite, every number and string compares
+// greater, so `WHERE col > :watermark` selects all rows.
+func (w *sqlWatermark) Param() interface{} {
+	if w.current == nil {
+		return int64(-1 << 63)
+	}
+	if t, ok := w.current.(time.Time); ok {
+		return t
+	}
+	return w.current
+}
+
+// Observe updates the run's maximum with a record's watermark column.
+func (w *sqlWatermark) Observe(record map[string]interface{}) {
+	v, ok := record[w.column]
+	if !ok || v == nil {
+		return
+	}
+	if w.max == nil || compareWatermarks(v, w.max) > 0 {
+		w.max = v
+	}
+}
+
+// Save stores the highest value seen, if it advanced.
+func (w *sqlWatermark) Save() (bool, error) {
+	if w.window != nil || w.max == nil || (w.current != nil && compareWatermarks(w.max, w.current) <= 0) {
+		return false, nil
+	}
+	w.current = w.max
+	w.max = nil
+	return true, w.store.Set(watermarkCacheKey, encodeWatermark(w.current))
+}
+
+// sqlTime converts a time into a watermark value: a timestamp for
+// PostgreSQL, and a string for SQLite and MySQL, whose text timestamps are
+// compared as strings. The string has the layout of like, a value of the
+// watermark column such as the stored watermark, so it orders correctly
+// against the column; it is RFC 3339 if like is not a text timestamp.
+func sqlTime(driver string, like interface{}) func(time.Time) interface{} {
+	layout, ok := textTimeLayout(like)
+	if !ok {
+		layout = time.RFC3339
+	}
+	return func(t time.Time) interface{} {
+		if driver == "pgx" {
+			return t
+		}
+		return t.UTC().Format(layout)
+	}
+}
+
+// textTimeLayout returns the layout of v if it is a text timestamp.
+func textTimeLayout(v interface{}) (string, bool) {
+	if s, ok := v.(string); ok {
+		for _, layout := range []string{time.RFC3339Nano, time.DateTime, "2006-01-02T15:04:05", time.DateOnly} {
+			if _, err := time.Parse(layout, s); err == nil {
+				return layout, true
+			}
+		}
+	}
+	return "", false
+}
+
+// timeWatermark returns the state entry that sets a node's watermark to v.
+func timeWatermark(column string, v interface{}) (string, string, error) {
+	if column == "" {
+		return "", "", errors.New("no watermarkColumn is configured")
+	}
+	return watermarkCacheKey, encodeWatermark(v), nil
+}
+
+// encodeWatermark stores a value with a type prefix so it is bound with the
+// same type after a restart.
+func encodeWatermark(v interface{}) string {
+	switch t := v.(type) {
+	case int64:
+		return "i:" + strconv.FormatInt(t, 10)
+	case int:
+		return "i:" + strconv.Itoa(t)
+	case int32:
+		return "i:" + strconv.FormatInt(int64(t), 10)
+	case float64:
+		return "f:" + strconv.FormatFloat(t, 'g', -1, 64)
+	case time.Time:
+		return "t:" + t.Format(time.RFC3339Nano)
+	}
+	return "s:" + fmt.Sprint(v)
+}
+
+func decodeWatermark(raw string) (interface{}, error) {
+	prefix, value, ok := strings.Cut(raw, ":")
+	if !ok {
+		return raw, nil
+	}
+	switch prefix {
+	case "i":
+		return strconv.ParseInt(value, 10, 64)
+	case "f":
+		return strconv.ParseFloat(value, 64)
+	case "t":
+		return time.Parse(time.RFC3339Nano, value)
+	case "s":
+		return value, nil
+	}
+	return raw, nil
+}
+
+// compareWatermarks orders two watermark values: numerically for numbers,
+// chronologically for timestamps and as strings otherwise.
+func compareWatermarks(a, b interface{}) int {
+	if x, ok := a.(int64); ok {
+		if y, ok := b.(int64); ok {
+			return cmp.Compare(x, y)
+		}
+	}
+	if x, ok := watermarkNumber(a); ok {
+		if y, ok := watermarkNumber(b); ok {
+			return cmp.Compare(x, y)
+		}
+	}
+	if x, ok := a.(time.Time); ok {
+		if y, ok := b.(time.Time); ok {
+			return x.Compare(y)
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func watermarkNumber(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case int:
+		return float64(t), true
+	case int32:
+		return float64(t), true
+	case int64:
+		return float64(t), true
+	case float64:
+		return t, true
+	}
+	return 0, false
+}
@@ -0,0 +1,324 @@
+package nodes
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"data-pipeline/helpers"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" database/sql driver
+)
+
+func init() {
+	Register("sqlite", NewSQLiteNode)
+}
+
+// SQLiteNodeConfig holds configuration for the SQLite sink node.
+type SQLiteNodeConfig struct {
+	DatabaseFile string   `mapstructure:"databaseFile"` // Path of the SQLite database
+	Table        string   `mapstructure:"table"`        // Table to write to; created if missing
+	KeyColumns   []string `mapstructure:"keyColumns"`   // Upsert on these columns instead of plain inserts
+}
+
+// SQLiteNode writes records into a SQLite table and passes them through. The
+// table is created from the record schema on first use and new fields are
+// added as columns (ALTER TABLE ... ADD COLUMN) as they appear. Each batch is
+// written in one transaction, so the node's `batchSize` is the transaction
+// size.
+//
+// # Pipeline configuration example
+//
+//	pipelines:
+//	  local_contacts:
+//	    - name: "StoreContacts"
+//	      type: "sqlite"
+//	      concurrency: 1
+//	      batchSize: 500 // records per transaction
+//	      config:
+//	        databaseFile: "./data/local.db"
+//	        table: "contacts"
+//	        keyColumns: ["id"] // optional: upsert instead of insert
+//
+// Integers and booleans are stored as INTEGER, numbers as REAL and strings,
+// timestamps (RFC3339) and nested values (JSON) as TEXT. With keyColumns, an
+// upsert only updates the fields present in the record.
+type SQLiteNode struct {
+	name   string
+	config SQLiteNodeConfig
+
+	mu      sync.Mutex
+	db      *sql.DB
+	columns map[string]bool // columns known to exist in the table
+}
+
+// NewSQLiteNode creates a new instance of the SQLite sink node.
+func NewSQLiteNode(name string, config map[string]interface{}) *SQLiteNode {
+	nodeConfig := SQLiteNodeConfig{
+		DatabaseFile: configString(config, "databaseFile", ""),
+		Table:        configString(config, "table", ""),
+		KeyColumns:   configStringSlice(config, "keyColumns"),
+	}
+	log.Printf("[%s] Initialized. Database: %s, table: %s", name, nodeConfig.DatabaseFile, nodeConfig.Table)
+	return &SQLiteNode{name: name, config: nodeConfig}
+}
+
+// Name returns the node's name.
+func (n *SQLiteNode) Name() string {
+	return n.name
+}
+
+// Process writes a batch in one transaction and returns the items unchanged.
+func (n *SQLiteNode) Process(ctx context.Context, items []interface{}) ([]interface{}, error) {
+	logPrefix := fmt.Sprintf("[%s]", n.Name())
+	if n.config.DatabaseFile == "" || n.config.Table == "" {
+		return nil, fmt.Errorf("%s 'databaseFile' and 'table' must be configured", logPrefix)
+	}
+	records := make([]map[string]interface{}, 0, len(items))
+	for i, item := range items {
+		record, ok := item.(map[string]interface{})
+		if !ok {
+			log.Printf("%s Warning: Skipping item %d as it's not a map[string]interface{}", logPrefix, i)
+			continue
+		}
+		records = append(records, record)
+	}
+	if len(records) == 0 {
+		return items, nil
+	}
+
+	// SQLite has a single writer; batches from concurrent workers are serialized.
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.open(ctx); err != nil {
+		return nil, fmt.Errorf("%s %w", logPrefix, err)
+	}
+	if err := n.migrate(ctx, records); err != nil {
+		return nil, fmt.Errorf("%s failed to migrate table %s: %w", logPrefix, n.config.Table, err)
+	}
+	written, err := n.write(ctx, records)
+	if err != nil {
+		return nil, fmt.Errorf("%s failed to write to %s: %w", logPrefix, n.config.Table, err)
+	}
+	log.Printf("%s Wrote %d record(s) to %s", logPrefix, written, n.config.Table)
+	return items, nil
+}
+
+// Close closes the database.
+func (n *SQLiteNode) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.db == nil {
+		return nil
+	}
+	err := n.db.Close()
+	n.db = nil
+	return err
+}
+
+// open connects to the database and loads the table's columns.
+func (n *SQLiteNode) open(ctx context.Context) error {
+	if n.db != nil {
+		return nil
+	}
+	db, err := openSQLite(n.config.DatabaseFile)
+	if err != nil {
+		return err
+	}
+	n.db = db
+	n.columns, err = sqliteColumns(ctx, db, n.config.Table)
+	return err
+}
+
+// migrate creates the table or adds columns for fields it does not have yet.
+func (n *SQLiteNode) migrate(ctx context.Context, records []map[string]interface{}) error {
+	types := make(map[string]string)
+	for _, record := range records {
+		for field, v := range record {
+			if types[field] == "" {
+				types[field] = sqliteType(v) // "" (untyped) while only nulls were seen
+			}
+		}
+	}
+	for _, key := range n.config.KeyColumns {
+		if _, ok := types[key]; !ok {
+			types[key] = ""
+		}
+	}
+
+	if len(n.columns) == 0 {
+		var defs []string
+		for _, col := range sortedKeys(types) {
+			defs = append(defs, strings.TrimSpace(quoteIdent(col)+" "+types[col]))
+		}
+		if len(n.config.KeyColumns) > 0 {
+			defs = append(defs, "PRIMARY KEY ("+quoteIdents(n.config.KeyColumns)+")")
+		}
+		stmt := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", quoteIdent(n.config.Table), strings.Join(defs, ", "))
+		if _, err := n.db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+		log.Printf("[%s] Created table %s with %d column(s)", n.Name(), n.config.Table, len(types))
+		for col := range types {
+			n.columns[col] = true
+		}
+		return nil
+	}
+
+	for _, col := range sortedKeys(types) {
+		if n.columns[col] {
+			continue
+		}
+		stmt := strings.TrimSpace(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", quoteIdent(n.config.Table), quoteIdent(col), types[col]))
+		if _, err := n.db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+		log.Printf("[%s] Added column %s to table %s", n.Name(), col, n.config.Table)
+		n.columns[col] = true
+	}
+	if len(n.config.KeyColumns) > 0 {
+		// Upserts need a unique index on the key, also for tables created elsewhere.
+		index := quoteIdent(n.config.Table + "_" + strings.Join(n.config.KeyColumns, "_") + "_key")
+		stmt := fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS %s ON %s (%s)", index, quoteIdent(n.config.Table), quoteIdents(n.config.KeyColumns))
+		if _, err := n.db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write inserts or upserts the records in one transaction. Records with the
+// same set of fields share a prepared statement.
+func (n *SQLiteNode) write(ctx context.Context, records []map[string]interface{}) (int64, error) {
+	tx, err := n.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	statements := make(map[string]*sql.Stmt)
+	var written int64
+	for _, record := range records {
+		columns := sortedKeys(record)
+		signature := strings.Join(columns, "\x00")
+		stmt, ok := statements[signature]
+		if !ok {
+			stmt, err = tx.PrepareContext(ctx, n.insertStatement(columns))
+			if err != nil {
+				return 0, err
+			}
+			defer stmt.Close()
+			statements[signature] = stmt
+		}
+		args := make([]interface{}, len(columns))
+		for i, col := range columns {
+			args[i] = sqlValue(record[col])
+		}
+		result, err := stmt.ExecContext(ctx, args...)
+		if err != nil {
+			return 0, err
+		}
+		if affected, err := result.RowsAffected(); err == nil {
+			written += affected
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return written, nil
+}
+
+// insertStatement builds the INSERT (or upsert) statement for a column set.
+func (n *SQLiteNode) insertStatement(columns []string) string {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	stmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", quoteIdent(n.config.Table), quoteIdents(columns), placeholders)
+	if len(n.config.KeyColumns) == 0 {
+		return stmt
+	}
+	keys := make(map[string]bool)
+	for _, k := range n.config.KeyColumns {
+		keys[k] = true
+	}
+	var updates []string
+	for _, col := range columns {
+		if !keys[col] {
+			updates = append(updates, fmt.Sprintf("%s = excluded.%s", quoteIdent(col), quoteIdent(col)))
+		}
+	}
+	if len(updates) == 0 {
+		return stmt + fmt.Sprintf(" ON CONFLICT (%s) DO NOTHING", quoteIdents(n.config.KeyColumns))
+	}
+	return stmt + fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s", quoteIdents(n.config.KeyColumns), strings.Join(updates, ", "))
+}
+
+// openSQLite opens a SQLite database, creating its directory if needed.
+func openSQLite(path string) (*sql.DB, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+// sqliteColumns returns the columns of table, or an empty set if it does not
+// exist.
+func sqliteColumns(ctx context.Context, db *sql.DB, table string) (map[string]bool, error) {
+	rows, err := db.QueryContext(ctx, "SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+	defer rows.Close()
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
+
+// sqliteType returns the column type for a record value, or "" for null.
+func sqliteType(v interface{}) string {
+	switch helpers.ValueType(v) {
+	case "integer", "boolean":
+		return "INTEGER"
+	case "number":
+		return "REAL"
+	case "null":
+		return ""
+	}
+	return "TEXT"
+}
+
+// quoteIdents quotes and joins column names.
+func quoteIdents(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteIdent(name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// sortedKeys returns the keys of m in sorted order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,139 @@
+package nodes
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+func init() {
+	Register("sqliteQuery", NewSQLiteQueryNode)
+}
+
+// SQLiteQueryNodeConfig holds configuration for the SQLite query source node.
+type SQLiteQueryNodeConfig struct {
+	DatabaseFile     string `mapstructure:"databaseFile"`     // Path of the SQLite database
+	Query            string `mapstructure:"query"`            // SELECT statement; may use :watermark
+	WatermarkColumn  string `mapstructure:"watermarkColumn"`  // Result column whose highest value is remembered
+	InitialWatermark string `mapstructure:"initialWatermark"` // Value of :watermark before the first load
+	CacheFilePath    string `mapstructure:"cacheFilePath"`    // Where the watermark is stored without a shared state store
+}
+
+// SQLiteQueryNode runs a query against a SQLite database and emits every row
+// as a map[string]interface{}.
+//
+// # Pipeline configuration example
+//
+//	pipelines:
+//	  local_contacts:
+//	    - name: "ChangedContacts"
+//	      type: "sqliteQuery"
+//	      config:
+//	        databaseFile: "./data/local.db"
+//	        query: "SELECT * FROM contacts WHERE updated_at > :watermark ORDER BY updated_at"
+//	        watermarkColumn: "updated_at"            // optional, enables incremental loads
+//	        initialWatermark: "2024-01-01T00:00:00Z" // optional
+//	        cacheFilePath: "./cache/changed_contacts_cache.json" // optional
+//
+// With a watermarkColumn, the highest value of that column is stored in the
+// node's state store after a successful run and bound to :watermark in the
+// next one, so each run only returns rows changed since the previous one.
+// Without a stored or initial watermark, :watermark selects all rows.
+type SQLiteQueryNode struct {
+	nodeState
+	name   string
+	config SQLiteQueryNodeConfig
+}
+
+// NewSQLiteQueryNode creates a new instance of the SQLite query source node.
+func NewSQLiteQueryNode(name string, config map[string]interface{}) *SQLiteQueryNode {
+	nodeConfig := SQLiteQueryNodeConfig{
+		DatabaseFile:     configString(config, "databaseFile", ""),
+		Query:            configString(config, "query", ""),
+		WatermarkColumn:  configString(config, "watermarkColumn", ""),
+		InitialWatermark: configString(config, "initialWatermark", ""),
+		CacheFilePath:    configString(config, "cacheFilePath", fmt.Sprintf("./cache/%s_cache.json", name)),
+	}
+	log.Printf("[%s] Initialized. Database: %s", name, nodeConfig.DatabaseFile)
+	return &SQLiteQueryNode{nodeState: nodeState{stateFile: nodeConfig.CacheFilePath}, name: name, config: nodeConfig}
+}
+
+// Name returns the node's name.
+func (n *SQLiteQueryNode) Name() string {
+	return n.name
+}
+
+// TimeWatermark returns the watermark that makes the next run select rows
+// whose watermark column is after t, as an RFC 3339 string.
+func (n *SQLiteQueryNode) TimeWatermark(t time.Time) (string, string, error) {
+	return timeWatermark(n.config.WatermarkColumn, sqlTime("sqlite", nil)(t))
+}
+
+// Process runs the query. It ignores the input 'items' as it's an import node.
+func (n *SQLiteQueryNode) Process(ctx context.Context, items []interface{}) ([]interface{}, error) {
+	logPrefix := fmt.Sprintf("[%s]", n.Name())
+	if n.config.DatabaseFile == "" || n.config.Query == "" {
+		return nil, fmt.Errorf("%s 'databaseFile' and 'query' must be configured", logPrefix)
+	}
+
+	var watermark *sqlWatermark
+	var args []interface{}
+	if n.config.WatermarkColumn != "" {
+		state, err := n.StateStore()
+		if err != nil {
+			return nil, fmt.Errorf("%s %w", logPrefix, err)
+		}
+		if watermark, err = newSQLWatermark(state, n.config.WatermarkColumn, n.config.InitialWatermark); err != nil {
+			return nil, fmt.Errorf("%s %w", logPrefix, err)
+		}
+		if info, ok := RunInfoFromContext(ctx); ok && info.Window != nil {
+			watermark.backfill(info.Window, "sqlite")
+		}
+	}
+	if strings.Contains(n.config.Query, ":watermark") {
+		if watermark == nil {
+			return nil, fmt.Errorf("%s query uses :watermark but 'watermarkColumn' is not configured", logPrefix)
+		}
+		args = append(args, sql.Named("watermark", watermark.Param()))
+	}
+
+	db, err := openSQLite(n.config.DatabaseFile)
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", logPrefix, err)
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, n.config.Query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s query failed: %w", logPrefix, err)
+	}
+	defer rows.Close()
+
+	var records []interface{}
+	err = scanRows(rows, func(record map[string]interface{}) error {
+		if watermark != nil {
+			if !watermark.Keep(record) {
+				return nil
+			}
+			watermark.Observe(record)
+		}
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s error reading rows: %w", logPrefix, err)
+	}
+
+	if watermark != nil {
+		if advanced, err := watermark.Save(); err != nil {
+			log.Printf("%s Warning: failed to store watermark: %v", logPrefix, err)
+		} else if advanced {
+			log.Printf("%s Stored watermark %v", logPrefix, watermark.current)
+		}
+	}
+	log.Printf("%s Successfully imported %d rows", logPrefix, len(records))
+	return records, nil
+}
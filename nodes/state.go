@@ -0,0 +1,69 @@
+package nodes
+
+import (
+	"sync"
+
+	"data-pipeline/helpers"
+)
+
+// nodeState gives a node access to its state store. Stateful nodes embed it,
+// which makes them StateAware: the orchestrator injects the store configured
+// in config.yaml, namespaced by pipeline and node name. Without one (e.g. no
+// `state` section, or a node used on its own) the node keeps its state in a
+// JSON file at its cacheFilePath, as it always has.
+type nodeState struct {
+	stateMu   sync.Mutex
+	stateFile string // fallback JSON file
+	store     helpers.StateStore
+	opened    *helpers.FileStateStore // the state file, once first used
+}
+
+// SetStateStore makes the node keep its state in store.
+func (s *nodeState) SetStateStore(store helpers.StateStore) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	s.store = store
+}
+
+// StateStore returns the injected store, or a store for the node's state
+// file. The file is opened, and locked, the first time that store is used.
+func (s *nodeState) StateStore() (helpers.StateStore, error) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	if s.store == nil {
+		s.store = helpers.LazyStateStore(s.openStateFile)
+	}
+	return s.store, nil
+}
+
+// openStateFile opens the node's state file unless it is open already.
+func (s *nodeState) openStateFile() (helpers.StateStore, error) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	if s.opened == nil {
+		store, err := helpers.NewFileStateStore(s.stateFile)
+		if err != nil {
+			return nil, err
+		}
+		s.opened = store
+	}
+	return s.opened, nil
+}
+
+// StateFile returns the path of the node's own state file.
+func (s *nodeState) StateFile() string {
+	return s.stateFile
+}
+
+// CloseState closes the state file if it was opened, which releases its
+// lock. Using the store afterwards opens it again.
+func (s *nodeState) CloseState() error {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	if s.opened == nil {
+		return nil
+	}
+	err := s.opened.Close()
+	s.opened = nil
+	return err
+}
@@ -0,0 +1,223 @@
+package nodes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+)
+
+func init() {
+	Register("validateSchema", NewValidateSchemaNode)
+}
+
+// ValidateSchemaNodeConfig holds configuration for the schema validation node.
+type ValidateSchemaNodeConfig struct {
+	SchemaFile  string `mapstructure:"schemaFile"`  // Path to the JSON Schema file
+	ErrorsField string `mapstructure:"errorsField"` // Field holding validation errors on rejected records (default "_errors")
+}
+
+// ValidateSchemaNode checks each record against a JSON Schema. Valid records
+// pass through; invalid records are copied to the node's error output with
+// their validation errors (instance path and message) under errorsField.
+// Per-field failure counts are logged once all batches have been validated.
+//
+// # Pipeline configuration example
+//
+//	pipelines:
+//	  main_contact_flow:
+//	    - name: "ValidateContacts"
+//	      type: "validateSchema"
+//	      config:
+//	        schemaFile: "./schemas/contact.schema.json"
+//	        errorsField: "_errors" // optional
+//	    - name: "StoreRejectedContacts"
+//	      type: "mongoPersist"
+//	      input: "ValidateContacts:errors"  // read the rejected records
+//	      config: {...}
+type ValidateSchemaNode struct {
+	name       string
+	config     ValidateSchemaNodeConfig
+	schema     *jsonschema.Schema
+	compileErr error
+
+	mu            sync.Mutex
+	rejected      []interface{}
+	fieldFailures map[string]int
+	validCount    int
+}
+
+// NewValidateSchemaNode creates a new instance of the node and compiles the
+// configured schema. Compilation errors are reported by Process.
+func NewValidateSchemaNode(name string, config map[string]interface{}) *ValidateSchemaNode {
+	nodeConfig := ValidateSchemaNodeConfig{
+		SchemaFile:  configString(config, "schemaFile", ""),
+		ErrorsField: configString(config, "errorsField", "_errors"),
+	}
+	node := &ValidateSchemaNode{
+		name:          name,
+		config:        nodeConfig,
+		fieldFailures: make(map[string]int),
+	}
+
+	if nodeConfig.SchemaFile == "" {
+		node.compileErr = errors.New("'schemaFile' is not configured")
+	} else {
+		node.schema, node.compileErr = jsonschema.NewCompiler().Compile(nodeConfig.SchemaFile)
+	}
+	if node.compileErr != nil {
+		log.Printf("[%s] Warning: could not load schema: %v", name, node.compileErr)
+	} else {
+		log.Printf("[%s] Initialized. Schema: %s", name, nodeConfig.SchemaFile)
+	}
+	return node
+}
+
+// Name returns the node's name.
+func (n *ValidateSchemaNode) Name() string {
+	return n.name
+}
+
+// Process validates a batch and returns the valid records.
+func (n *ValidateSchemaNode) Process(ctx context.Context, items []interface{}) ([]interface{}, error) {
+	logPrefix := fmt.Sprintf("[%s]", n.Name())
+	if n.compileErr != nil {
+		return nil, fmt.Errorf("%s invalid schema: %w", logPrefix, n.compileErr)
+	}
+
+	var valid, rejected []interface{}
+	failures := make(map[string]int)
+	for _, item := range items {
+		violations, err := n.validate(item)
+		if err != nil {
+			return nil, fmt.Errorf("%s %w", logPrefix, err)
+		}
+		if len(violations) == 0 {
+			valid = append(valid, item)
+			continue
+		}
+		errorList := make([]interface{}, len(violations))
+		for i, v := range violations {
+			failures[v.path]++
+			errorList[i] = map[string]interface{}{"path": v.path, "message": v.message}
+		}
+		rejected = append(rejected, n.rejectedRecord(item, errorList))
+	}
+
+	n.mu.Lock()
+	n.validCount += len(valid)
+	n.rejected = append(n.rejected, rejected...)
+	for path, count := range failures {
+		n.fieldFailures[path] += count
+	}
+	n.mu.Unlock()
+
+	if len(rejected) > 0 {
+		log.Printf("%s %d of %d items failed validation.", logPrefix, len(rejected), len(items))
+	}
+	return valid, nil
+}
+
+// Flush logs the validation summary with per-field failure counts.
+func (n *ValidateSchemaNode) Flush(ctx context.Context) ([]interface{}, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	log.Printf("[%s] Validation summary: %d valid, %d invalid.", n.Name(), n.validCount, len(n.rejected))
+	paths := make([]string, 0, len(n.fieldFailures))
+	for path := range n.fieldFailures {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		log.Printf("[%s]   %s: %d failure(s)", n.Name(), path, n.fieldFailures[path])
+	}
+	n.fieldFailures = make(map[string]int)
+	n.validCount = 0
+	return nil, nil
+}
+
+// TakeErrors returns the records rejected so far and clears them.
+func (n *ValidateSchemaNode) TakeErrors() []interface{} {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	rejected := n.rejected
+	n.rejected = nil
+	return rejected
+}
+
+// schemaViolation is a single validation failure at an instance path.
+type schemaViolation struct {
+	path    string
+	message string
+}
+
+// validate returns the violations of item against the schema. Items are
+// round-tripped through JSON so that Go-specific types (int, time.Time, ...)
+// are validated as their JSON representation.
+func (n *ValidateSchemaNode) validate(item interface{}) ([]schemaViolation, error) {
+	raw, err := json.Marshal(item)
+	if err != nil {
+		return []schemaViolation{{path: "", message: fmt.Sprintf("record is not JSON-serializable: %v", err)}}, nil
+	}
+	instance, err := jsonschema.UnmarshalJSON(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode record for validation: %w", err)
+	}
+
+	err = n.schema.Validate(instance)
+	if err == nil {
+		return nil, nil
+	}
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	var violations []schemaViolation
+	for _, unit := range validationErr.BasicOutput().Errors {
+		if unit.Error == nil {
+			continue
+		}
+		// Report missing required properties at the property's own path so
+		// failure counts are per field rather than per parent object.
+		if required, ok := unit.Error.Kind.(*kind.Required); ok {
+			for _, field := range required.Missing {
+				violations = append(violations, schemaViolation{path: unit.InstanceLocation + "/" + field, message: "missing required property"})
+			}
+			continue
+		}
+		path := unit.InstanceLocation
+		if path == "" {
+			path = "/"
+		}
+		violations = append(violations, schemaViolation{path: path, message: unit.Error.String()})
+	}
+	if len(violations) == 0 {
+		violations = append(violations, schemaViolation{path: "/", message: strings.TrimSpace(err.Error())})
+	}
+	return violations, nil
+}
+
+// rejectedRecord copies a record and attaches its validation errors.
+// Non-map items are wrapped in a record under "record".
+func (n *ValidateSchemaNode) rejectedRecord(item interface{}, errorList []interface{}) map[string]interface{} {
+	out := make(map[string]interface{})
+	if m, ok := item.(map[string]interface{}); ok {
+		for k, v := range m {
+			out[k] = v
+		}
+	} else {
+		out["record"] = item
+	}
+	out[n.config.ErrorsField] = errorList
+	return out
+}
@@ -3,50 +3,583 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"os"
+	"path/filepath"
+	"slices"
 	"sync"
 	"time"
 
+	"data-pipeline/helpers"
 	"data-pipeline/nodes"
 )
 
+// noInput is the value of a node's `input` field that starts a new branch:
+// the node runs with no input instead of the previous node's output.
+const noInput = "none"
+
+// errorOutputSuffix is appended to a node's name to refer to its error output.
+const errorOutputSuffix = ":errors"
+
+// pipelineLocks configures the per-pipeline run locks (see LockConfig).
+var pipelineLocks LockConfig
+
+// shutdownGrace is how long batches already handed to a node may take to
+// finish once their run is stopped (see ShutdownConfig).
+var shutdownGrace = defaultShutdownGrace
+
+// stateStore is the shared state store (see StateConfig), or nil if nodes
+// keep their state in their own files.
+var stateStore helpers.StateStore
+
 // RunPipeline orchestrates a single named pipeline.
-func RunPipeline(ctx context.Context, pipelineName string, pipelineNodes []nodes.PipelineNode) error {
-	// currentData is the evolving dataset for *this specific pipeline run*
-	var currentData []interface{}
-	currentData = []interface{}{} // Start fresh for each pipeline run
+func RunPipeline(ctx context.Context, pipelineName string, pipelineCfg PipelineConfig) error {
+	return runPipeline(ctx, pipelineName, pipelineCfg, runOptions{})
+}
 
-	log.Printf("[%s] Starting execution.", pipelineName)
+// runOptions changes how runPipeline runs a pipeline.
+type runOptions struct {
+	// window makes the run a backfill of one time slice (see
+	// nodes.TimeWindow). Backfill runs take no pipeline lock, since the
+	// backfill holds its own, and read a snapshot of the node state that is
+	// never committed, so they neither lock nor move the live watermarks.
+	window *nodes.TimeWindow
+	// runID is the ID of the run; a new one is generated if empty.
+	runID string
+	// progress, if set, receives the progress of every node.
+	progress *runStatus
+}
+
+func runPipeline(ctx context.Context, pipelineName string, pipelineCfg PipelineConfig, opts runOptions) (err error) {
+	pipelineNodes := pipelineCfg.Nodes
+
+	started := time.Now()
+	runID := opts.runID
+	if runID == "" {
+		runID = newRunID()
+	}
+	log.Printf("[%s] Starting execution (run %s).", pipelineName, runID)
 
 	if len(pipelineNodes) == 0 {
 		log.Printf("[%s] Pipeline has no nodes defined.", pipelineName)
 		return nil // Or return an error if empty pipelines are invalid
 	}
 
-	for i, nodeCfg := range pipelineNodes {
-		nodeLogPrefix := fmt.Sprintf("[%s | Node %d: %s]", pipelineName, i+1, nodeCfg.Name) // Add pipeline name to logs
+	// Only one process may run a pipeline at a time; the lock is taken before
+	// nodes are created because node constructors open their caches.
+	if opts.window == nil {
+		lock, err := lockPipeline(pipelineName)
+		if err != nil {
+			return err
+		}
+		defer lock.Release()
+	}
+	if shared, ok := stateStore.(*helpers.SharedFileStateStore); ok && opts.window == nil {
+		// Keep the shared state file open, and locked, for the whole run.
+		held, err := shared.Open()
+		if err != nil {
+			return fmt.Errorf("pipeline '%s' failed to open the state store: %w", pipelineName, err)
+		}
+		defer held.Close()
+	}
 
+	// Instantiate all nodes up front so configuration errors surface before any
+	// node runs, and so we know which outputs later nodes refer to.
+	instances := make([]nodes.Node, len(pipelineNodes))
+	state := make([]*helpers.StagedStateStore, len(pipelineNodes))
+	for i, nodeCfg := range pipelineNodes {
+		nodeLogPrefix := fmt.Sprintf("[%s | Node %d: %s]", pipelineName, i+1, nodeCfg.Name)
 		nodeInstance, err := nodes.GetNodeInstance(nodeCfg)
 		if err != nil {
 			return fmt.Errorf("%s failed to instantiate: %w", nodeLogPrefix, err)
 		}
+		if aware, ok := nodeInstance.(nodes.ConcurrencyAware); ok {
+			aware.SetConcurrency(max(nodeCfg.Concurrency, 1))
+		}
+		if aware, ok := nodeInstance.(nodes.StateAware); ok {
+			stage := stageState
+			if opts.window != nil {
+				stage = snapshotState
+			}
+			staged, err := stage(aware, pipelineName, nodeCfg.Name)
+			if err != nil {
+				return fmt.Errorf("%s failed to open state: %w", nodeLogPrefix, err)
+			}
+			state[i] = staged
+		}
+		instances[i] = nodeInstance
+	}
+	defer flushCaches(pipelineName)
+	defer closeNodes(pipelineName, instances)
+	if opts.window != nil && !slices.ContainsFunc(instances, isTimeWatermarked) {
+		return fmt.Errorf("pipeline '%s' cannot be backfilled: no node has a time-based watermark", pipelineName)
+	}
+	referenced, err := referencedOutputs(pipelineNodes, instances)
+	if err != nil {
+		return fmt.Errorf("pipeline '%s' is misconfigured: %w", pipelineName, err)
+	}
+	if err := pipelineCfg.validate(); err != nil {
+		return fmt.Errorf("pipeline '%s' is misconfigured: %w", pipelineName, err)
+	}
+
+	// Backfill slices hold historical data, which must not become the drift
+	// baseline of live runs.
+	var schemas *schemaTracker
+	if opts.window == nil {
+		schemas, err = newSchemaTracker(pipelineCfg.SchemaDrift, pipelineName, runID)
+		if err != nil {
+			return fmt.Errorf("pipeline '%s' schema tracking: %w", pipelineName, err)
+		}
+	}
+	if schemas != nil {
+		defer func() {
+			if saveErr := schemas.save(err == nil); saveErr != nil {
+				log.Printf("[%s] Warning: failed to store inferred schema: %v", pipelineName, saveErr)
+			}
+		}()
+	}
+
+	run := &pipelineRun{
+		name:       pipelineName,
+		nodes:      pipelineNodes,
+		instances:  instances,
+		referenced: referenced,
+		schemas:    schemas,
+		state:      state,
+		commitAt:   pipelineCfg.commitIndex(),
+		backfill:   opts.window != nil,
+		progress:   opts.progress,
+	}
+
+	info := nodes.RunInfo{Pipeline: pipelineName, RunID: runID, Started: started, Window: opts.window}
+	if source, ok := instances[0].(nodes.StreamingSource); ok && source.Streaming() {
+		info.Streaming = true
+		return run.stream(nodes.WithRunInfo(ctx, info), source)
+	}
+	ctx = nodes.WithRunInfo(ctx, info)
+
+	currentData, err := run.runFrom(ctx, 0, []interface{}{}, make(map[string][]interface{}))
+	if err == nil {
+		err = run.commitState()
+	}
+	if err != nil {
+		run.discardState()
+		if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+			log.Printf("[%s] Run %s cancelled after %v.", pipelineName, runID, time.Since(started).Round(time.Millisecond))
+		}
+		return err
+	}
+	log.Printf("[%s] Pipeline complete. Final data length: %d", pipelineName, len(currentData))
+	return nil
+}
+
+// pipelineRun holds the instantiated nodes of one pipeline run.
+type pipelineRun struct {
+	name       string
+	nodes      []nodes.PipelineNode
+	instances  []nodes.Node
+	referenced map[string]bool
+	schemas    *schemaTracker
+	state      []*helpers.StagedStateStore // staged state of StateAware nodes, by index
+	commitAt   int                         // node after which state is committed, or -1
+	backfill   bool                        // state is never committed
+	progress   *runStatus                  // progress tracking, or nil
+}
+
+// stream drives a pipeline whose first node is a streaming source: every
+// micro-batch the source emits runs through the remaining nodes before the
+// source continues.
+func (r *pipelineRun) stream(ctx context.Context, source nodes.StreamingSource) error {
+	sourceCfg := r.nodes[0]
+	sourceLogPrefix := fmt.Sprintf("[%s | Node 1: %s]", r.name, sourceCfg.Name)
+	log.Printf("%s streaming; each micro-batch runs through the remaining %d node(s).", sourceLogPrefix, len(r.nodes)-1)
+
+	batches, records := 0, 0
+	started := time.Now()
+	r.progress.nodeStarted(0, 0)
+	if r.schemas != nil {
+		r.schemas.streaming = true
+	}
+	if aware, ok := source.(nodes.StateAware); ok && r.state[0] != nil {
+		aware.SetStateStore(&sourceStateStore{StagedStateStore: r.state[0], run: r})
+	}
+	err := source.Stream(ctx, func(ctx context.Context, items []interface{}) error {
+		batches++
+		records += len(items)
+		r.progress.sourceEmitted(len(items))
+		outputs := make(map[string][]interface{})
+		if r.referenced[sourceCfg.Name] {
+			outputs[sourceCfg.Name] = items
+		}
+		if r.schemas != nil {
+			if err := r.schemas.observe(sourceCfg.Name, items, sourceLogPrefix); err != nil {
+				return fmt.Errorf("pipeline '%s' failed at node '%s': %w", r.name, sourceCfg.Name, err)
+			}
+		}
+		if _, err := r.runFrom(ctx, 1, items, outputs); err != nil {
+			return err
+		}
+		return r.commitState()
+	})
+	r.progress.sourceEnded(time.Since(started), err)
+	if err != nil {
+		// The source's progress is committed as it records it; the changes
+		// later nodes made to an unfinished micro-batch are dropped.
+		r.discardState()
+		if !(errors.Is(err, context.Canceled) && ctx.Err() != nil) {
+			return fmt.Errorf("pipeline '%s' failed at node '%s': %w", r.name, sourceCfg.Name, err)
+		}
+	} else if err := r.commitState(); err != nil {
+		return err
+	}
+	if r.schemas != nil {
+		if err := r.schemas.finish(fmt.Sprintf("[%s]", r.name)); err != nil {
+			return fmt.Errorf("pipeline '%s' failed: %w", r.name, err)
+		}
+	}
+	log.Printf("[%s] Stream ended after %d micro-batch(es), %d record(s).", r.name, batches, records)
+	return nil
+}
+
+// sourceStateStore is the state store of a streaming source. Sources record
+// their progress once emit has returned, when the micro-batch has run through
+// the pipeline and the state of later nodes has been committed, so their
+// changes are committed at once instead of with the next micro-batch: a
+// restart while the source waits for data does not replay the last one.
+type sourceStateStore struct {
+	*helpers.StagedStateStore
+	run *pipelineRun
+}
+
+func (s *sourceStateStore) Set(key, value string) error {
+	if err := s.StagedStateStore.Set(key, value); err != nil {
+		return err
+	}
+	return s.commit()
+}
+
+func (s *sourceStateStore) Delete(key string) error {
+	if err := s.StagedStateStore.Delete(key); err != nil {
+		return err
+	}
+	return s.commit()
+}
+
+func (s *sourceStateStore) CompareAndSwap(key, old, value string) (bool, error) {
+	swapped, err := s.StagedStateStore.CompareAndSwap(key, old, value)
+	if err != nil || !swapped {
+		return swapped, err
+	}
+	return true, s.commit()
+}
+
+func (s *sourceStateStore) Apply(set map[string]string, del []string) error {
+	if err := s.StagedStateStore.Apply(set, del); err != nil {
+		return err
+	}
+	return s.commit()
+}
+
+// commit commits the source's changes unless the run is a backfill.
+func (s *sourceStateStore) commit() error {
+	if s.run.backfill {
+		return nil
+	}
+	if err := s.StagedStateStore.Commit(); err != nil {
+		return fmt.Errorf("pipeline '%s' failed to commit state of node '%s': %w", s.run.name, s.run.nodes[0].Name, err)
+	}
+	return nil
+}
+
+// runFrom runs the nodes from index start onwards with currentData as the
+// input of the first of them, and returns the output of the last node.
+// outputs holds the outputs of earlier nodes that later nodes refer to.
+func (r *pipelineRun) runFrom(ctx context.Context, start int, currentData []interface{}, outputs map[string][]interface{}) ([]interface{}, error) {
+	for i := start; i < len(r.nodes); i++ {
+		nodeCfg := r.nodes[i]
+		nodeLogPrefix := fmt.Sprintf("[%s | Node %d: %s]", r.name, i+1, nodeCfg.Name) // Add pipeline name to logs
+		nodeInstance := r.instances[i]
+
+		switch nodeCfg.Input {
+		case "":
+			// Default: consume the previous node's output
+		case noInput:
+			currentData = []interface{}{}
+		default:
+			currentData = outputs[nodeCfg.Input]
+		}
+		if consumer, ok := nodeInstance.(nodes.UpstreamConsumer); ok {
+			for _, upstream := range consumer.UpstreamNodes() {
+				consumer.SetUpstream(upstream, outputs[upstream])
+			}
+		}
 
 		// Pass the enhanced log prefix down to runNode
+		r.progress.nodeStarted(i, len(currentData))
+		nodeStart := time.Now()
 		out, err := runNode(ctx, nodeInstance, currentData, nodeCfg.Concurrency, nodeCfg.BatchSize, nodeLogPrefix)
+		r.progress.nodeFinished(i, len(out), time.Since(nodeStart), err)
 		if err != nil {
 			// Error already includes node name/prefix from runNode
-			return fmt.Errorf("pipeline '%s' failed at node '%s': %w", pipelineName, nodeCfg.Name, err)
+			return nil, fmt.Errorf("pipeline '%s' failed at node '%s': %w", r.name, nodeCfg.Name, err)
+		}
+
+		if r.schemas != nil {
+			if err := r.schemas.observe(nodeCfg.Name, out, nodeLogPrefix); err != nil {
+				return nil, fmt.Errorf("pipeline '%s' failed at node '%s': %w", r.name, nodeCfg.Name, err)
+			}
+		}
+		if i == r.commitAt {
+			if err := r.commitState(); err != nil {
+				return nil, err
+			}
 		}
 
 		// The output of the current node is the input to the next node
 		currentData = out
+		if r.referenced[nodeCfg.Name] {
+			outputs[nodeCfg.Name] = out
+		}
+		if errNode, ok := nodeInstance.(nodes.ErrorOutputNode); ok {
+			rejected := errNode.TakeErrors()
+			if len(rejected) > 0 {
+				log.Printf("%s diverted %d item(s) to its error output.", nodeLogPrefix, len(rejected))
+			}
+			if r.referenced[nodeCfg.Name+errorOutputSuffix] {
+				outputs[nodeCfg.Name+errorOutputSuffix] = rejected
+			}
+		}
 	}
+	return currentData, nil
+}
 
-	log.Printf("[%s] Pipeline complete. Final data length: %d", pipelineName, len(currentData))
+// nodeStateStore returns where a node keeps its state: its namespace in the
+// shared state store if one is configured, and otherwise the node's own.
+func nodeStateStore(node nodes.StateAware, pipelineName, nodeName string) (helpers.StateStore, error) {
+	if stateStore == nil {
+		return node.StateStore()
+	}
+	store := helpers.NamespacedStateStore(stateStore, pipelineName+"/"+nodeName+"/")
+	if err := importStateFile(node, store, pipelineName, nodeName); err != nil {
+		return nil, fmt.Errorf("failed to import %s: %w", node.StateFile(), err)
+	}
+	return store, nil
+}
+
+// importStateFile copies the state a node kept in its own file, before a
+// shared state store was configured, into the node's namespace if that is
+// still empty. The file is renamed to "<file>.imported" afterwards, so state
+// deleted later (e.g. by `state reset`) is not imported again.
+func importStateFile(node nodes.StateAware, store helpers.StateStore, pipelineName, nodeName string) error {
+	path := node.StateFile()
+	if path == "" {
+		return nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil // nothing to import
+	}
+	existing, err := store.List("")
+	if err != nil || len(existing) > 0 {
+		return err
+	}
+	own, err := node.StateStore()
+	if err != nil {
+		return err
+	}
+	entries, err := own.List("")
+	if closeErr := node.CloseState(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := helpers.ApplyState(store, entries, nil); err != nil {
+		return err
+	}
+	if err := os.Rename(path, path+".imported"); err != nil {
+		return err
+	}
+	log.Printf("[%s] Imported %d state key(s) of node '%s' from %s.", pipelineName, len(entries), nodeName, path)
 	return nil
 }
 
+// stageState gives a StateAware node a store that holds back its changes
+// until the run commits them.
+func stageState(node nodes.StateAware, pipelineName, nodeName string) (*helpers.StagedStateStore, error) {
+	store, err := nodeStateStore(node, pipelineName, nodeName)
+	if err != nil {
+		return nil, err
+	}
+	staged := helpers.NewStagedStateStore(store)
+	node.SetStateStore(staged)
+	return staged, nil
+}
+
+// snapshotState gives a StateAware node of a backfill run a store that
+// starts from a copy of the node's live state (see stateSnapshot); the
+// changes the node stages are never committed.
+func snapshotState(node nodes.StateAware, pipelineName, nodeName string) (*helpers.StagedStateStore, error) {
+	store, err := stateSnapshot(node, pipelineName, nodeName)
+	if err != nil {
+		return nil, err
+	}
+	staged := helpers.NewStagedStateStore(store)
+	node.SetStateStore(staged)
+	return staged, nil
+}
+
+// stateSnapshot returns a copy of a node's live state. State files are read
+// without taking their locks, so readers do not block running pipelines or
+// fail while they run; other shared stores are returned as they are.
+func stateSnapshot(node nodes.StateAware, pipelineName, nodeName string) (helpers.StateStore, error) {
+	switch shared := stateStore.(type) {
+	case nil:
+		return helpers.SnapshotStateFile(node.StateFile())
+	case *helpers.SharedFileStateStore:
+		snapshot, err := shared.Snapshot()
+		if err != nil {
+			return nil, err
+		}
+		return helpers.NamespacedStateStore(snapshot, pipelineName+"/"+nodeName+"/"), nil
+	default:
+		return helpers.NamespacedStateStore(stateStore, pipelineName+"/"+nodeName+"/"), nil
+	}
+}
+
+// commitState writes the state changes staged by the nodes so far.
+func (r *pipelineRun) commitState() error {
+	if r.backfill {
+		return nil
+	}
+	for i, staged := range r.state {
+		if staged == nil || !staged.Pending() {
+			continue
+		}
+		if err := staged.Commit(); err != nil {
+			return fmt.Errorf("pipeline '%s' failed to commit state of node '%s': %w", r.name, r.nodes[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// discardState drops the state changes staged by a failed run, so the next
+// run starts from the last committed watermarks and offsets.
+func (r *pipelineRun) discardState() {
+	discarded := 0
+	for _, staged := range r.state {
+		if staged != nil && staged.Pending() {
+			staged.Discard()
+			discarded++
+		}
+	}
+	if discarded > 0 {
+		log.Printf("[%s] Discarded uncommitted state of %d node(s).", r.name, discarded)
+	}
+}
+
+// isTimeWatermarked reports whether a node has a time-based watermark, and
+// so reads only its slice in a backfill run.
+func isTimeWatermarked(node nodes.Node) bool {
+	watermarked, ok := node.(nodes.TimeWatermarked)
+	if !ok {
+		return false
+	}
+	_, _, err := watermarked.TimeWatermark(time.Time{})
+	return err == nil
+}
+
+// closeNodes releases resources held by nodes (open files, connections,
+// their state files) in reverse order once the pipeline has finished,
+// whether it succeeded or not.
+func closeNodes(pipelineName string, instances []nodes.Node) {
+	for i := len(instances) - 1; i >= 0; i-- {
+		if instances[i] == nil {
+			continue
+		}
+		if closer, ok := instances[i].(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				log.Printf("[%s] Warning: failed to close node '%s': %v", pipelineName, instances[i].Name(), err)
+			}
+		}
+		if aware, ok := instances[i].(nodes.StateAware); ok {
+			if err := aware.CloseState(); err != nil {
+				log.Printf("[%s] Warning: failed to close the state of node '%s': %v", pipelineName, instances[i].Name(), err)
+			}
+		}
+	}
+}
+
+// lockPipeline takes the run lock of a pipeline, waiting up to
+// pipelineLocks.Wait for a running instance to finish.
+func lockPipeline(pipelineName string) (*helpers.FileLock, error) {
+	lock, err := helpers.AcquireFileLock(lockFile(pipelineName), pipelineLocks.Wait)
+	if errors.Is(err, helpers.ErrLocked) {
+		return nil, fmt.Errorf("pipeline '%s' is already running: %w", pipelineName, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("pipeline '%s' could not be locked: %w", pipelineName, err)
+	}
+	return lock, nil
+}
+
+// lockFile returns the path of the named lock file in the lock directory.
+func lockFile(name string) string {
+	dir := pipelineLocks.Dir
+	if dir == "" {
+		dir = defaultLockDir
+	}
+	return filepath.Join(dir, name+".lock")
+}
+
+// flushCaches saves cache changes held back by write-behind (see
+// helpers.SetDefaultWriteBehind) once the nodes have been closed.
+func flushCaches(pipelineName string) {
+	if err := helpers.FlushCaches(); err != nil {
+		log.Printf("[%s] Warning: failed to save caches: %v", pipelineName, err)
+	}
+}
+
+// newRunID returns a unique, time-ordered identifier for a pipeline run.
+func newRunID() string {
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	return time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix)
+}
+
+// referencedOutputs returns the names of node outputs (including error outputs)
+// that are read by a later node, either through its `input` field or as an
+// upstream of an UpstreamConsumer. References to unknown or later nodes are
+// rejected.
+func referencedOutputs(pipelineNodes []nodes.PipelineNode, instances []nodes.Node) (map[string]bool, error) {
+	seen := make(map[string]bool)
+	referenced := make(map[string]bool)
+	for i, nodeCfg := range pipelineNodes {
+		refs := []string{}
+		if nodeCfg.Input != "" && nodeCfg.Input != noInput {
+			refs = append(refs, nodeCfg.Input)
+		}
+		if consumer, ok := instances[i].(nodes.UpstreamConsumer); ok {
+			refs = append(refs, consumer.UpstreamNodes()...)
+		}
+		for _, ref := range refs {
+			if !seen[ref] {
+				return nil, fmt.Errorf("node '%s' refers to '%s', which is not an earlier node", nodeCfg.Name, ref)
+			}
+			referenced[ref] = true
+		}
+		seen[nodeCfg.Name] = true
+		if _, ok := instances[i].(nodes.ErrorOutputNode); ok {
+			seen[nodeCfg.Name+errorOutputSuffix] = true
+		}
+	}
+	return referenced, nil
+}
+
 // runNode executes a single node, now accepts a logPrefix.
 func runNode(ctx context.Context, node nodes.Node, items []interface{}, concurrency, batchSize int, logPrefix string) ([]interface{}, error) {
 	start := time.Now()
@@ -65,13 +598,24 @@ func runNode(ctx context.Context, node nodes.Node, items []interface{}, concurre
 		concurrency = 1
 	}
 
+	// Batches are only started while ctx is live; batches already started
+	// keep running for up to shutdownGrace after it is cancelled.
+	work, release := graceContext(ctx, shutdownGrace)
+	defer release()
+
 	// Special case: If input is empty, still call Process once for nodes that generate data (like importers)
 	if inputItemCount == 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("%s stopped before processing: %w", logPrefix, err)
+		}
 		log.Printf("%s processing 0 input items.", logPrefix)
-		out, err := node.Process(ctx, []interface{}{}) // Call with empty slice
+		out, err := node.Process(work, []interface{}{}) // Call with empty slice
 		if err != nil {
 			return nil, fmt.Errorf("%s processing error: %w", logPrefix, err)
 		}
+		if out, err = flushNode(work, node, out, logPrefix); err != nil {
+			return nil, err
+		}
 		log.Printf("%s finished in %v. Processed 0 items -> %d items.",
 			logPrefix, time.Since(start), len(out))
 		return out, nil
@@ -91,8 +635,12 @@ func runNode(ctx context.Context, node nodes.Node, items []interface{}, concurre
 		// --- Sequential Execution ---
 		for i, batch := range batches {
 			batchLogPrefix := fmt.Sprintf("%s Batch %d/%d", logPrefix, i+1, numBatches)
+			if err := ctx.Err(); err != nil {
+				errChan <- fmt.Errorf("%s not started: %w", batchLogPrefix, err)
+				break
+			}
 			log.Printf("%s processing %d items...", batchLogPrefix, len(batch))
-			out, err := node.Process(ctx, batch)
+			out, err := node.Process(work, batch)
 			if err != nil {
 				errChan <- fmt.Errorf("%s error: %w", batchLogPrefix, err)
 				break // Stop processing further batches on error
@@ -114,13 +662,13 @@ func runNode(ctx context.Context, node nodes.Node, items []interface{}, concurre
 			for batch := range batchesChan {
 				batchCounter++
 				batchLogPrefix := fmt.Sprintf("%s Worker %d Batch %d", logPrefix, workerID, batchCounter) // Log worker ID
-				log.Printf("%s processing %d items...", batchLogPrefix, len(batch))
 				select {
-				case <-ctx.Done(): // Check if context was cancelled
-					errChan <- fmt.Errorf("%s context cancelled", batchLogPrefix)
+				case <-ctx.Done(): // Don't start new batches once the run is stopped
+					errChan <- fmt.Errorf("%s not started: %w", batchLogPrefix, ctx.Err())
 					return
 				default:
-					out, err := node.Process(ctx, batch) // Pass context to node
+					log.Printf("%s processing %d items...", batchLogPrefix, len(batch))
+					out, err := node.Process(work, batch) // Pass context to node
 					if err != nil {
 						// Send error and potentially stop processing more items
 						errChan <- fmt.Errorf("%s error: %w", batchLogPrefix, err)
@@ -153,6 +701,11 @@ func runNode(ctx context.Context, node nodes.Node, items []interface{}, concurre
 		return nil, err
 	}
 
+	combinedOutput, err := flushNode(work, node, combinedOutput, logPrefix)
+	if err != nil {
+		return nil, err
+	}
+
 	// Final log for the node
 	log.Printf("%s finished in %v. Processed %d items -> %d items.",
 		logPrefix, time.Since(start), inputItemCount, len(combinedOutput))
@@ -160,6 +713,40 @@ func runNode(ctx context.Context, node nodes.Node, items []interface{}, concurre
 	return combinedOutput, nil
 }
 
+// graceContext returns a context for work that has already started: it has
+// the values of ctx but is cancelled only grace after ctx is, or when release
+// is called.
+func graceContext(ctx context.Context, grace time.Duration) (context.Context, context.CancelFunc) {
+	work, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		timer := time.NewTimer(grace)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			cancel()
+		case <-work.Done():
+		}
+	})
+	return work, func() {
+		stop()
+		cancel()
+	}
+}
+
+// flushNode lets nodes that buffer across batches emit their remaining output
+// once all batches have been processed.
+func flushNode(ctx context.Context, node nodes.Node, out []interface{}, logPrefix string) ([]interface{}, error) {
+	flusher, ok := node.(nodes.Flusher)
+	if !ok {
+		return out, nil
+	}
+	flushed, err := flusher.Flush(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s flush error: %w", logPrefix, err)
+	}
+	return append(out, flushed...), nil
+}
+
 // chunkItems splits a slice into smaller slices (batches) of size n.
 func chunkItems(items []interface{}, n int) [][]interface{} {
 	if n <= 0 {
@@ -0,0 +1,903 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"data-pipeline/helpers"
+	"data-pipeline/nodes"
+)
+
+// recordingNode is a test node that emits its configured items and records
+// every item it receives.
+type recordingNode struct {
+	name     string
+	emit     []interface{}
+	received *[]interface{}
+}
+
+func (n *recordingNode) Name() string { return n.name }
+
+func (n *recordingNode) Process(ctx context.Context, items []interface{}) ([]interface{}, error) {
+	*n.received = append(*n.received, items...)
+	if len(items) == 0 {
+		return n.emit, nil
+	}
+	return items, nil
+}
+
+// registerRecordingNode registers a "recording" node type whose config
+// "emit" list is returned when called without input. Received items are
+// collected per node name.
+func registerRecordingNode(received map[string]*[]interface{}) {
+	nodes.RegisterNode("recording", func(name string, config map[string]interface{}) nodes.Node {
+		emit, _ := config["emit"].([]interface{})
+		rec := &[]interface{}{}
+		received[name] = rec
+		return &recordingNode{name: name, emit: emit, received: rec}
+	})
+}
+
+func TestRunPipelineBranchInput(t *testing.T) {
+	received := make(map[string]*[]interface{})
+	registerRecordingNode(received)
+
+	pipeline := []nodes.PipelineNode{
+		{Name: "A", Type: "recording", Config: map[string]interface{}{"emit": []interface{}{"a1", "a2"}}},
+		{Name: "B", Type: "recording", Input: "none", Config: map[string]interface{}{"emit": []interface{}{"b1"}}},
+		{Name: "C", Type: "recording", Input: "A"},
+	}
+	if err := RunPipeline(context.Background(), "test", PipelineConfig{Nodes: pipeline}); err != nil {
+		t.Fatalf("RunPipeline error: %v", err)
+	}
+	if len(*received["B"]) != 0 {
+		t.Errorf("expected B to start a new branch, got input %v", *received["B"])
+	}
+	if want := []interface{}{"a1", "a2"}; !reflect.DeepEqual(*received["C"], want) {
+		t.Errorf("expected C to receive A's output %v, got %v", want, *received["C"])
+	}
+}
+
+func TestRunPipelineRejectsForwardReference(t *testing.T) {
+	registerRecordingNode(make(map[string]*[]interface{}))
+	pipeline := []nodes.PipelineNode{
+		{Name: "A", Type: "recording", Input: "B"},
+		{Name: "B", Type: "recording"},
+	}
+	if err := RunPipeline(context.Background(), "test", PipelineConfig{Nodes: pipeline}); err == nil {
+		t.Fatal("expected an error for a reference to a later node")
+	}
+}
+
+// rejectingNode passes strings through and diverts everything else to its
+// error output.
+type rejectingNode struct {
+	name     string
+	rejected []interface{}
+}
+
+func (n *rejectingNode) Name() string { return n.name }
+
+func (n *rejectingNode) Process(ctx context.Context, items []interface{}) ([]interface{}, error) {
+	var out []interface{}
+	for _, item := range items {
+		if _, ok := item.(string); ok {
+			out = append(out, item)
+		} else {
+			n.rejected = append(n.rejected, item)
+		}
+	}
+	return out, nil
+}
+
+func (n *rejectingNode) TakeErrors() []interface{} {
+	rejected := n.rejected
+	n.rejected = nil
+	return rejected
+}
+
+func TestRunPipelineErrorOutput(t *testing.T) {
+	received := make(map[string]*[]interface{})
+	registerRecordingNode(received)
+	nodes.RegisterNode("rejecting", func(name string, config map[string]interface{}) nodes.Node {
+		return &rejectingNode{name: name}
+	})
+
+	pipeline := []nodes.PipelineNode{
+		{Name: "Source", Type: "recording", Config: map[string]interface{}{"emit": []interface{}{"ok", 1, "fine", 2}}},
+		{Name: "Validate", Type: "rejecting"},
+		{Name: "Good", Type: "recording"},
+		{Name: "Bad", Type: "recording", Input: "Validate:errors"},
+	}
+	if err := RunPipeline(context.Background(), "test", PipelineConfig{Nodes: pipeline}); err != nil {
+		t.Fatalf("RunPipeline error: %v", err)
+	}
+	if want := []interface{}{"ok", "fine"}; !reflect.DeepEqual(*received["Good"], want) {
+		t.Errorf("Good: got %v, want %v", *received["Good"], want)
+	}
+	if want := []interface{}{1, 2}; !reflect.DeepEqual(*received["Bad"], want) {
+		t.Errorf("Bad: got %v, want %v", *received["Bad"], want)
+	}
+}
+
+// streamingNode emits each of its configured batches through the stream and
+// records how many of them downstream nodes accepted.
+type streamingNode struct {
+	name     string
+	batches  [][]interface{}
+	accepted *int
+}
+
+func (n *streamingNode) Name() string { return n.name }
+
+func (n *streamingNode) Process(ctx context.Context, items []interface{}) ([]interface{}, error) {
+	return nil, errors.New("Process must not be called on a streaming source")
+}
+
+func (n *streamingNode) Streaming() bool { return true }
+
+func (n *streamingNode) Stream(ctx context.Context, emit func(ctx context.Context, items []interface{}) error) error {
+	for _, batch := range n.batches {
+		if err := emit(ctx, batch); err != nil {
+			return err
+		}
+		*n.accepted++
+	}
+	return nil
+}
+
+func TestRunPipelineStreamingSource(t *testing.T) {
+	received := make(map[string]*[]interface{})
+	registerRecordingNode(received)
+	accepted := 0
+	nodes.RegisterNode("streaming", func(name string, config map[string]interface{}) nodes.Node {
+		return &streamingNode{name: name, batches: [][]interface{}{{"a", "b"}, {"c"}}, accepted: &accepted}
+	})
+
+	pipeline := []nodes.PipelineNode{
+		{Name: "Source", Type: "streaming"},
+		{Name: "Sink", Type: "recording"},
+		{Name: "Tap", Type: "recording", Input: "Source"},
+	}
+	if err := RunPipeline(context.Background(), "test", PipelineConfig{Nodes: pipeline}); err != nil {
+		t.Fatalf("RunPipeline error: %v", err)
+	}
+	if accepted != 2 {
+		t.Errorf("expected 2 micro-batches to be accepted, got %d", accepted)
+	}
+	want := []interface{}{"a", "b", "c"}
+	if !reflect.DeepEqual(*received["Sink"], want) {
+		t.Errorf("Sink: got %v, want %v", *received["Sink"], want)
+	}
+	if !reflect.DeepEqual(*received["Tap"], want) {
+		t.Errorf("Tap: got %v, want %v", *received["Tap"], want)
+	}
+}
+
+func TestRunPipelineStreamingExportCSV(t *testing.T) {
+	accepted := 0
+	row := func(id string) interface{} { return map[string]interface{}{"id": id} }
+	nodes.RegisterNode("streaming", func(name string, config map[string]interface{}) nodes.Node {
+		return &streamingNode{name: name, batches: [][]interface{}{{row("1"), row("2")}, {row("2"), row("3")}, {row("4")}}, accepted: &accepted}
+	})
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out.csv")
+	pipeline := []nodes.PipelineNode{
+		{Name: "Source", Type: "streaming"},
+		{Name: "Dedupe", Type: "dedupe", Config: map[string]interface{}{"keys": []interface{}{"id"}, "cacheFilePath": filepath.Join(dir, "seen.json")}},
+		{Name: "Export", Type: "exportCSV", Config: map[string]interface{}{"destinationFile": out}},
+	}
+	if err := RunPipeline(context.Background(), "test", PipelineConfig{Nodes: pipeline}); err != nil {
+		t.Fatalf("RunPipeline error: %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if want := "id\n1\n2\n3\n4\n"; string(data) != want {
+		t.Errorf("expected every micro-batch in one file without duplicates, got %q", data)
+	}
+}
+
+func TestRunPipelineStreamingCommitsSourceProgress(t *testing.T) {
+	received := make(map[string]*[]interface{})
+	registerRecordingNode(received)
+	stateStore = helpers.NewMemoryStateStore()
+	defer func() { stateStore = nil }()
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "app.log")
+	os.WriteFile(logFile, []byte(`{"event":"a1"}`+"\n"), 0644)
+	pipeline := []nodes.PipelineNode{
+		{Name: "Tail", Type: "importFiles", Config: map[string]interface{}{"paths": logFile, "follow": true, "pollInterval": "5ms"}},
+		{Name: "Sink", Type: "recording"},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- RunPipeline(ctx, "tail", PipelineConfig{Nodes: pipeline}) }()
+	// While the source waits for more data, the position past the
+	// micro-batch it emitted is already committed.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		entries, _ := stateStore.List("tail/Tail/")
+		if len(entries) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the source's position to be committed while the stream is idle")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("RunPipeline error: %v", err)
+	}
+}
+
+func TestRunPipelineSchemaDrift(t *testing.T) {
+	registerRecordingNode(make(map[string]*[]interface{}))
+	storeDir := t.TempDir()
+	run := func(record map[string]interface{}) error {
+		return RunPipeline(context.Background(), "drift", PipelineConfig{
+			Nodes: []nodes.PipelineNode{
+				{Name: "Source", Type: "recording", Config: map[string]interface{}{"emit": []interface{}{record}}},
+			},
+			SchemaDrift: SchemaDriftConfig{Enabled: true, StoreDir: storeDir, OnFieldAdded: "fail", KeepRuns: 2},
+		})
+	}
+	if err := run(map[string]interface{}{"id": 1}); err != nil {
+		t.Fatalf("first run: %v", err)
+	}
+	if err := run(map[string]interface{}{"id": 2}); err != nil {
+		t.Fatalf("unchanged schema: %v", err)
+	}
+	if err := run(map[string]interface{}{"id": 3, "extra": true}); err == nil {
+		t.Error("expected new field to fail the run")
+	}
+	if err := run(map[string]interface{}{"id": "4"}); err == nil {
+		t.Error("expected type change to fail the run")
+	}
+	files, _ := filepath.Glob(filepath.Join(storeDir, "drift", "*.json"))
+	if len(files) != 3 {
+		t.Errorf("expected latest.json and the 2 newest run files, got %v", files)
+	}
+}
+
+func TestRunPipelineStreamingSchemaDrift(t *testing.T) {
+	storeDir := t.TempDir()
+	accepted := 0
+	run := func(batches ...[]interface{}) error {
+		nodes.RegisterNode("streaming", func(name string, config map[string]interface{}) nodes.Node {
+			return &streamingNode{name: name, batches: batches, accepted: &accepted}
+		})
+		return RunPipeline(context.Background(), "drift", PipelineConfig{
+			Nodes:       []nodes.PipelineNode{{Name: "Source", Type: "streaming"}},
+			SchemaDrift: SchemaDriftConfig{Enabled: true, StoreDir: storeDir, OnFieldRemoved: "fail"},
+		})
+	}
+	note := []interface{}{map[string]interface{}{"id": 1, "note": "vip"}}
+	plain := []interface{}{map[string]interface{}{"id": 2}}
+	if err := run(note, plain); err != nil {
+		t.Fatalf("first run: %v", err)
+	}
+	var latest map[string]*helpers.Schema
+	data, _ := os.ReadFile(filepath.Join(storeDir, "drift", "latest.json"))
+	if err := json.Unmarshal(data, &latest); err != nil || latest["Source"].Records != 2 || latest["Source"].Fields["note"] == nil {
+		t.Fatalf("expected the schema of every micro-batch to be stored, got %s (%v)", data, err)
+	}
+	// A micro-batch without the optional field is not a removal.
+	if err := run(plain, note); err != nil {
+		t.Errorf("expected an optional field missing from one micro-batch to pass, got %v", err)
+	}
+	if err := run(plain, plain); err == nil || !strings.Contains(err.Error(), `"note" disappeared`) {
+		t.Errorf("expected a field missing from the whole stream to fail the run, got %v", err)
+	}
+}
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "pipeline-locks")
+	if err != nil {
+		panic(err)
+	}
+	pipelineLocks.Dir = dir
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestRunPipelineAlreadyRunning(t *testing.T) {
+	held, err := helpers.AcquireFileLock(filepath.Join(pipelineLocks.Dir, "locked.lock"), 0)
+	if err != nil {
+		t.Fatalf("AcquireFileLock error: %v", err)
+	}
+	pipeline := []nodes.PipelineNode{{Name: "src", Type: "recording"}}
+	err = RunPipeline(context.Background(), "locked", PipelineConfig{Nodes: pipeline})
+	if !errors.Is(err, helpers.ErrLocked) || !strings.Contains(err.Error(), "already running") {
+		t.Fatalf("expected an already running error, got %v", err)
+	}
+
+	// With a wait, the run starts once the other instance is done.
+	pipelineLocks.Wait = 5 * time.Second
+	defer func() { pipelineLocks.Wait = 0 }()
+	time.AfterFunc(200*time.Millisecond, func() { held.Release() })
+	if err := RunPipeline(context.Background(), "locked", PipelineConfig{Nodes: pipeline}); err != nil {
+		t.Fatalf("expected the run to wait for the lock, got %v", err)
+	}
+}
+
+func TestRunPipelineInjectsStateStore(t *testing.T) {
+	received := make(map[string]*[]interface{})
+	registerRecordingNode(received)
+	stateStore = helpers.NewMemoryStateStore()
+	defer func() { stateStore = nil }()
+
+	contacts := []interface{}{map[string]interface{}{"id": "1"}, map[string]interface{}{"id": "2"}}
+	pipeline := []nodes.PipelineNode{
+		{Name: "Source", Type: "recording", Config: map[string]interface{}{"emit": contacts}},
+		{Name: "Dedupe", Type: "dedupe", Config: map[string]interface{}{"keys": []interface{}{"id"}, "persistAcrossRuns": true}},
+		{Name: "Sink", Type: "recording"},
+	}
+	for run := 1; run <= 2; run++ {
+		if err := RunPipeline(context.Background(), "contacts", PipelineConfig{Nodes: pipeline}); err != nil {
+			t.Fatalf("run %d: RunPipeline error: %v", run, err)
+		}
+	}
+	if got := len(*received["Sink"]); got != 0 {
+		t.Errorf("expected the second run to drop keys seen in the first, got %d record(s)", got)
+	}
+	entries, _ := stateStore.List("contacts/Dedupe/")
+	if len(entries) != 2 {
+		t.Errorf("expected 2 seen keys namespaced by pipeline and node, got %v", entries)
+	}
+}
+
+func TestRunPipelineReleasesStateFiles(t *testing.T) {
+	registerRecordingNode(make(map[string]*[]interface{}))
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "seen.json")
+	pipeline := []nodes.PipelineNode{
+		{Name: "Source", Type: "recording", Config: map[string]interface{}{"emit": []interface{}{map[string]interface{}{"id": "1"}}}},
+		{Name: "Dedupe", Type: "dedupe", Config: map[string]interface{}{"keys": []interface{}{"id"}, "persistAcrossRuns": true, "cacheFilePath": cachePath}},
+	}
+	if err := RunPipeline(context.Background(), "contacts", PipelineConfig{Nodes: pipeline}); err != nil {
+		t.Fatalf("RunPipeline error: %v", err)
+	}
+	// Another process, such as `state set` next to a running daemon, can now
+	// take the node's cache file.
+	lock, err := helpers.AcquireFileLock(cachePath+".lock", 0)
+	if err != nil {
+		t.Fatalf("expected the cache file to be released after the run, got %v", err)
+	}
+	lock.Release()
+
+	statePath := filepath.Join(dir, "state.json")
+	stateStore, _ = helpers.OpenStateStore(helpers.StateBackendFile, statePath)
+	defer func() { stateStore = nil }()
+	if err := RunPipeline(context.Background(), "contacts", PipelineConfig{Nodes: pipeline}); err != nil {
+		t.Fatalf("RunPipeline error: %v", err)
+	}
+	if entries, _ := stateStore.List("contacts/Dedupe/"); len(entries) != 1 {
+		t.Errorf("expected the seen key in the shared state file, got %v", entries)
+	}
+	lock, err = helpers.AcquireFileLock(statePath+".lock", 0)
+	if err != nil {
+		t.Fatalf("expected the shared state file to be released after the run, got %v", err)
+	}
+	lock.Release()
+}
+
+func TestRunPipelineOpensStateFilesOnUse(t *testing.T) {
+	registerRecordingNode(make(map[string]*[]interface{}))
+	cachePath := filepath.Join(t.TempDir(), "seen.json")
+	pipeline := []nodes.PipelineNode{
+		{Name: "Source", Type: "recording", Config: map[string]interface{}{"emit": []interface{}{map[string]interface{}{"id": "1"}}}},
+		{Name: "Dedupe", Type: "dedupe", Config: map[string]interface{}{"keys": []interface{}{"id"}, "cacheFilePath": cachePath}},
+	}
+	if err := RunPipeline(context.Background(), "contacts", PipelineConfig{Nodes: pipeline}); err != nil {
+		t.Fatalf("RunPipeline error: %v", err)
+	}
+	// Without persistAcrossRuns the node never uses its state file.
+	if _, err := os.Stat(cachePath + ".lock"); !os.IsNotExist(err) {
+		t.Errorf("expected the unused state file not to be opened, got %v", err)
+	}
+}
+
+func TestNodeStateStoreImportsStateFile(t *testing.T) {
+	stateStore = helpers.NewMemoryStateStore()
+	defer func() { stateStore = nil }()
+	path := filepath.Join(t.TempDir(), "seen.json")
+	os.WriteFile(path, []byte(`{"watermark": "2025-01-01"}`), 0644)
+	node, err := nodes.GetNodeInstance(nodes.PipelineNode{Name: "Dedupe", Type: "dedupe", Config: map[string]interface{}{"keys": []interface{}{"id"}, "cacheFilePath": path}})
+	if err != nil {
+		t.Fatalf("GetNodeInstance error: %v", err)
+	}
+	if _, err := nodeStateStore(node.(nodes.StateAware), "contacts", "Dedupe"); err != nil {
+		t.Fatalf("nodeStateStore error: %v", err)
+	}
+	if v, _, _ := stateStore.Get("contacts/Dedupe/watermark"); v != "2025-01-01" {
+		t.Errorf("expected the state file to be imported into the node's namespace, got %q", v)
+	}
+	if _, err := os.Stat(path + ".imported"); err != nil {
+		t.Errorf("expected the imported file to be renamed: %v", err)
+	}
+
+	// Node names identify state, so they must be unique.
+	cfg := PipelineConfig{Nodes: []nodes.PipelineNode{{Name: "Dedupe", Type: "dedupe"}, {Name: "Dedupe", Type: "dedupe"}}}
+	if err := cfg.validate(); err == nil || !strings.Contains(err.Error(), "more than once") {
+		t.Errorf("expected duplicate node names to be rejected, got %v", err)
+	}
+}
+
+// failingNode fails every Process call.
+type failingNode struct{ name string }
+
+func (n *failingNode) Name() string { return n.name }
+
+func (n *failingNode) Process(ctx context.Context, items []interface{}) ([]interface{}, error) {
+	return nil, errors.New("downstream unavailable")
+}
+
+func TestRunPipelineCommitsStateOnSuccess(t *testing.T) {
+	registerRecordingNode(make(map[string]*[]interface{}))
+	nodes.RegisterNode("failing", func(name string, config map[string]interface{}) nodes.Node {
+		return &failingNode{name: name}
+	})
+	stateStore = helpers.NewMemoryStateStore()
+	defer func() { stateStore = nil }()
+
+	contacts := []interface{}{map[string]interface{}{"id": "1"}}
+	run := func(commitAfter string, last string) error {
+		return RunPipeline(context.Background(), "contacts", PipelineConfig{
+			Nodes: []nodes.PipelineNode{
+				{Name: "Source", Type: "recording", Config: map[string]interface{}{"emit": contacts}},
+				{Name: "Dedupe", Type: "dedupe", Config: map[string]interface{}{"keys": []interface{}{"id"}, "persistAcrossRuns": true}},
+				{Name: "Notify", Type: last},
+			},
+			CommitAfter: commitAfter,
+		})
+	}
+	if err := run("", "failing"); err == nil {
+		t.Fatal("expected the run to fail")
+	}
+	if entries, _ := stateStore.List("contacts/"); len(entries) != 0 {
+		t.Errorf("expected a failed run to discard its state, got %v", entries)
+	}
+
+	if err := run("Dedupe", "failing"); err == nil {
+		t.Fatal("expected the run to fail")
+	}
+	if entries, _ := stateStore.List("contacts/Dedupe/"); len(entries) != 1 {
+		t.Errorf("expected state to be committed after the commit point, got %v", entries)
+	}
+
+	if err := run("Missing", "recording"); err == nil || !strings.Contains(err.Error(), "commitAfter") {
+		t.Errorf("expected an unknown commit point to be rejected, got %v", err)
+	}
+}
+
+func TestStateCommand(t *testing.T) {
+	registerRecordingNode(make(map[string]*[]interface{}))
+	stateStore = helpers.NewMemoryStateStore()
+	defer func() { stateStore = nil }()
+	cfg := &AppConfig{Pipelines: map[string]PipelineConfig{"contacts": {Nodes: []nodes.PipelineNode{
+		{Name: "Hubspot", Type: "importHubspotContacts"},
+		{Name: "Sink", Type: "recording"},
+	}}}}
+	run := func(cmd string, opts stateOptions) (string, error) {
+		var out strings.Builder
+		opts.pipeline = "contacts"
+		err := runStateCommand(cfg, cmd, opts, &out)
+		return out.String(), err
+	}
+
+	if _, err := run("set", stateOptions{node: "Hubspot", from: "2025-01-01"}); err != nil {
+		t.Fatalf("set --from error: %v", err)
+	}
+	if v, _, _ := stateStore.Get("contacts/Hubspot/time_offset"); v != "1735689600000" {
+		t.Errorf("expected time_offset of 2025-01-01 in ms, got %q", v)
+	}
+	if _, err := run("set", stateOptions{node: "Hubspot", args: []string{"cursor", "abc"}}); err != nil {
+		t.Fatalf("set error: %v", err)
+	}
+	out, err := run("list", stateOptions{})
+	if err != nil || !strings.Contains(out, "time_offset") || !strings.Contains(out, "cursor") {
+		t.Errorf("list: got %q, %v", out, err)
+	}
+	if out, _ := run("get", stateOptions{node: "Hubspot", args: []string{"cursor"}}); out != "abc\n" {
+		t.Errorf("get: got %q", out)
+	}
+	if _, err := run("set", stateOptions{node: "Sink", from: "2025-01-01"}); err == nil {
+		t.Error("expected a stateless node to be rejected")
+	}
+
+	held, _ := helpers.AcquireFileLock(filepath.Join(pipelineLocks.Dir, "contacts.lock"), 0)
+	if _, err := run("reset", stateOptions{node: "Hubspot"}); err == nil || !strings.Contains(err.Error(), "already running") {
+		t.Errorf("expected reset to fail while the pipeline runs, got %v", err)
+	}
+	held.Release()
+	if _, err := run("reset", stateOptions{node: "Hubspot"}); err != nil {
+		t.Fatalf("reset error: %v", err)
+	}
+	if entries, _ := stateStore.List(""); len(entries) != 0 {
+		t.Errorf("expected reset to delete the node's state, got %v", entries)
+	}
+}
+
+func TestStateCommandReadsLockedStateFiles(t *testing.T) {
+	registerRecordingNode(make(map[string]*[]interface{}))
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "seen.json")
+	cfg := &AppConfig{Pipelines: map[string]PipelineConfig{"contacts": {Nodes: []nodes.PipelineNode{
+		{Name: "Source", Type: "recording", Config: map[string]interface{}{"emit": []interface{}{map[string]interface{}{"id": "1"}}}},
+		{Name: "Dedupe", Type: "dedupe", Config: map[string]interface{}{"keys": []interface{}{"id"}, "persistAcrossRuns": true, "cacheFilePath": cachePath}},
+	}}}}
+	statePath := filepath.Join(dir, "state.json")
+	for _, shared := range []helpers.StateStore{nil, helpers.NewSharedFileStateStore(statePath)} {
+		stateStore = shared
+		lockPath := cachePath + ".lock"
+		if shared != nil {
+			lockPath = statePath + ".lock"
+		}
+		if err := RunPipeline(context.Background(), "contacts", cfg.Pipelines["contacts"]); err != nil {
+			t.Fatalf("RunPipeline error: %v", err)
+		}
+
+		// A running pipeline holds the lock of its state file; list and get
+		// still read it.
+		held, err := helpers.AcquireFileLock(lockPath, 0)
+		if err != nil {
+			t.Fatalf("AcquireFileLock error: %v", err)
+		}
+		var out strings.Builder
+		if err := runStateCommand(cfg, "list", stateOptions{pipeline: "contacts", node: "Dedupe"}, &out); err != nil {
+			t.Errorf("list error: %v", err)
+		}
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("expected the seen key in the list, got %q", out.String())
+		}
+		key := strings.Fields(lines[1])[1]
+		out.Reset()
+		if err := runStateCommand(cfg, "get", stateOptions{pipeline: "contacts", node: "Dedupe", args: []string{key}}, &out); err != nil || out.Len() == 0 {
+			t.Errorf("get: got %q, %v", out.String(), err)
+		}
+		if err := runStateCommand(cfg, "reset", stateOptions{pipeline: "contacts", node: "Dedupe"}, &out); err == nil {
+			t.Error("expected reset to fail while the state file is locked")
+		}
+		held.Release()
+	}
+	stateStore = nil
+}
+
+// collectingNode appends the items it receives to a list shared by all its
+// instances, so it can be used by parallel runs.
+type collectingNode struct {
+	name string
+	mu   *sync.Mutex
+	got  *[]interface{}
+}
+
+func (n *collectingNode) Name() string { return n.name }
+
+func (n *collectingNode) Process(ctx context.Context, items []interface{}) ([]interface{}, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	*n.got = append(*n.got, items...)
+	return items, nil
+}
+
+func TestBackfill(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "contacts.db")
+	db, err := sql.Open("sqlite", dbFile)
+	if err != nil {
+		t.Fatalf("sql.Open error: %v", err)
+	}
+	_, err = db.Exec(`CREATE TABLE contacts (id INTEGER, updated_at TEXT);
+		INSERT INTO contacts VALUES (1, '2023-12-31T12:00:00Z'), (2, '2024-01-01T00:00:00Z'),
+			(3, '2024-01-07T23:00:00Z'), (4, '2024-01-08T00:00:00Z'), (5, '2024-01-14T00:00:00Z'),
+			(6, '2024-01-15T00:00:00Z')`)
+	db.Close()
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	var mu sync.Mutex
+	var got []interface{}
+	nodes.RegisterNode("collecting", func(name string, config map[string]interface{}) nodes.Node {
+		return &collectingNode{name: name, mu: &mu, got: &got}
+	})
+	stateStore = helpers.NewMemoryStateStore()
+	defer func() { stateStore = nil }()
+	stateStore.Set("contacts/Contacts/watermark", "s:2024-06-01T00:00:00Z")
+
+	cfg := &AppConfig{Pipelines: map[string]PipelineConfig{"contacts": {Nodes: []nodes.PipelineNode{
+		{Name: "Contacts", Type: "sqliteQuery", Config: map[string]interface{}{
+			"databaseFile":    dbFile,
+			"query":           "SELECT id, updated_at FROM contacts WHERE updated_at > :watermark",
+			"watermarkColumn": "updated_at",
+		}},
+		{Name: "Sink", Type: "collecting"},
+	}, SchemaDrift: SchemaDriftConfig{Enabled: true, StoreDir: filepath.Join(dir, "schemas")}}}}
+	opts := backfillOptions{
+		pipeline: "contacts",
+		from:     time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		to:       time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC),
+		chunk:    7 * 24 * time.Hour,
+		parallel: 2,
+	}
+	if err := runBackfill(context.Background(), cfg, opts); err != nil {
+		t.Fatalf("runBackfill error: %v", err)
+	}
+	var ids []int64
+	for _, item := range got {
+		ids = append(ids, item.(map[string]interface{})["id"].(int64))
+	}
+	slices.Sort(ids)
+	if want := []int64{2, 3, 4, 5}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("expected each record of the range once, got ids %v", ids)
+	}
+	if v, _, _ := stateStore.Get("contacts/Contacts/watermark"); v != "s:2024-06-01T00:00:00Z" {
+		t.Errorf("expected the live watermark to be untouched, got %q", v)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "schemas")); !os.IsNotExist(err) {
+		t.Errorf("expected backfill runs not to store schemas, got %v", err)
+	}
+
+	// A completed backfill has nothing left to run.
+	got = nil
+	if err := runBackfill(context.Background(), cfg, opts); err != nil || len(got) != 0 {
+		t.Errorf("expected the rerun to skip completed slices, got %d record(s), %v", len(got), err)
+	}
+
+	// Slices read a snapshot of the live state, so they do not fail while a
+	// live run in another process holds the state file.
+	backfillDir = filepath.Join(dir, "backfill")
+	defer func() { backfillDir = "./cache/backfill" }()
+	statePath := filepath.Join(dir, "state.json")
+	live := `{"contacts/Contacts/watermark": "s:2024-06-01T00:00:00Z"}`
+	os.WriteFile(statePath, []byte(live), 0644)
+	stateStore = helpers.NewSharedFileStateStore(statePath)
+	lock, err := helpers.AcquireFileLock(statePath+".lock", 0)
+	if err != nil {
+		t.Fatalf("AcquireFileLock error: %v", err)
+	}
+	defer lock.Release()
+	got = nil
+	if err := runBackfill(context.Background(), cfg, opts); err != nil || len(got) != 4 {
+		t.Errorf("expected the backfill to run next to a live run, got %d record(s), %v", len(got), err)
+	}
+	if data, _ := os.ReadFile(statePath); string(data) != live {
+		t.Errorf("expected the live state to be untouched, got %s", data)
+	}
+}
+
+// blockingNode counts its runs and blocks each one until release is closed.
+type blockingNode struct {
+	name    string
+	started chan struct{}
+	release chan struct{}
+}
+
+func (n *blockingNode) Name() string { return n.name }
+
+func (n *blockingNode) Process(ctx context.Context, items []interface{}) ([]interface{}, error) {
+	n.started <- struct{}{}
+	<-n.release
+	return items, nil
+}
+
+func TestScheduledPipelineOverlap(t *testing.T) {
+	for _, tc := range []struct {
+		overlap string
+		runs    int
+	}{{overlapSkip, 1}, {overlapQueue, 2}} {
+		t.Run(tc.overlap, func(t *testing.T) {
+			started, release := make(chan struct{}, 4), make(chan struct{})
+			nodes.RegisterNode("blocking", func(name string, config map[string]interface{}) nodes.Node {
+				return &blockingNode{name: name, started: started, release: release}
+			})
+			cfg := PipelineConfig{
+				Nodes:    []nodes.PipelineNode{{Name: "Slow", Type: "blocking"}},
+				Schedule: ScheduleConfig{Cron: "@every 1h", Overlap: tc.overlap},
+			}
+			if err := cfg.validate(); err != nil {
+				t.Fatalf("validate error: %v", err)
+			}
+			p := &scheduledPipeline{name: "scheduled", cfg: cfg, runs: newRunRegistry()}
+			done := make(chan struct{})
+			go func() {
+				p.trigger()
+				close(done)
+			}()
+			<-started
+			p.trigger() // fires while the first run is in progress
+			p.trigger()
+			close(release)
+			<-done
+			if len(started) != tc.runs-1 {
+				t.Errorf("expected %d run(s), got %d", tc.runs, len(started)+1)
+			}
+		})
+	}
+}
+
+func TestScheduleConfigValidate(t *testing.T) {
+	for _, s := range []ScheduleConfig{
+		{Cron: "61 * * * *"},
+		{Cron: "0 * * * *", Timezone: "Mars/Olympus"},
+		{Cron: "0 * * * *", Overlap: "parallel"},
+	} {
+		if err := s.validate(); err == nil {
+			t.Errorf("expected %+v to be rejected", s)
+		}
+	}
+	s := ScheduleConfig{Cron: "0 6 * * 1-5", Timezone: "Europe/Berlin"}
+	if err := s.validate(); err != nil || s.Overlap != overlapSkip {
+		t.Errorf("expected a valid schedule defaulting to skip, got %v, %q", err, s.Overlap)
+	}
+}
+
+// waitingNode signals started and then blocks until its context is done.
+type waitingNode struct {
+	name    string
+	limit   interface{}
+	started chan interface{}
+}
+
+func (n *waitingNode) Name() string { return n.name }
+
+func (n *waitingNode) Process(ctx context.Context, items []interface{}) ([]interface{}, error) {
+	n.started <- n.limit
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestAPIRunLifecycle(t *testing.T) {
+	started := make(chan interface{}, 1)
+	nodes.RegisterNode("waiting", func(name string, config map[string]interface{}) nodes.Node {
+		return &waitingNode{name: name, limit: config["limit"], started: started}
+	})
+	cfg := &AppConfig{Pipelines: map[string]PipelineConfig{
+		"api": {Nodes: []nodes.PipelineNode{{Name: "Wait", Type: "waiting", Config: map[string]interface{}{"limit": 1}}}},
+	}}
+	// Cancelled runs give running batches shutdownGrace to finish.
+	defer func(grace time.Duration) { shutdownGrace = grace }(shutdownGrace)
+	shutdownGrace = 10 * time.Millisecond
+	runs := newRunRegistry()
+	server := httptest.NewServer((&apiServer{cfg: cfg, runs: runs, token: "s3cret"}).handler())
+	defer server.Close()
+
+	token := "wrong"
+	do := func(method, path, body string, wantStatus int, v interface{}) {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != wantStatus {
+			t.Fatalf("%s %s: expected status %d, got %d", method, path, wantStatus, resp.StatusCode)
+		}
+		if v != nil {
+			if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+				t.Fatalf("%s %s: decoding response: %v", method, path, err)
+			}
+		}
+	}
+
+	do("GET", "/pipelines", "", http.StatusUnauthorized, nil)
+	token = "s3cret"
+	do("POST", "/pipelines/missing/runs", "", http.StatusNotFound, nil)
+	do("POST", "/pipelines/api/runs", `{"overrides": {"Nope": {"limit": 2}}}`, http.StatusBadRequest, nil)
+	do("POST", "/pipelines/api/runs", `{"overrides": {"Wait": {"cacheFilePath": "/etc/passwd"}}}`, http.StatusBadRequest, nil)
+	do("POST", "/pipelines/api/runs", `{"overrides": {"Wait": {"right": {"source": {"type": "jsonl", "path": "/etc/passwd"}}}}}`, http.StatusBadRequest, nil)
+	do("POST", "/pipelines/api/runs", `{"overrides": {"Wait": {"follow": true}}}`, http.StatusBadRequest, nil)
+
+	var run runInfo
+	do("POST", "/pipelines/api/runs", `{"overrides": {"Wait": {"limit": 5}}}`, http.StatusAccepted, &run)
+	if limit := <-started; limit != 5.0 {
+		t.Errorf("expected the override limit 5, got %v", limit)
+	}
+	do("POST", "/pipelines/api/runs", "", http.StatusConflict, nil)
+
+	var pipelines []pipelineInfo
+	do("GET", "/pipelines", "", http.StatusOK, &pipelines)
+	if len(pipelines) != 1 || pipelines[0].RunningRun != run.ID || pipelines[0].Nodes[0].Type != "waiting" {
+		t.Errorf("unexpected pipelines: %+v", pipelines)
+	}
+
+	do("DELETE", "/runs/"+run.ID, "", http.StatusAccepted, nil)
+	runs.wait()
+	var status runInfo
+	do("GET", "/runs/"+run.ID, "", http.StatusOK, &status)
+	if status.Status != statusCancelled || status.Nodes[0].Status != statusFailed || status.Finished == nil {
+		t.Errorf("expected a cancelled run, got %+v", status)
+	}
+	do("DELETE", "/runs/"+run.ID, "", http.StatusConflict, nil)
+	do("GET", "/runs/unknown", "", http.StatusNotFound, nil)
+	if cfg.Pipelines["api"].Nodes[0].Config["limit"] != 1 {
+		t.Errorf("overrides changed the pipeline config")
+	}
+}
+
+// slowNode blocks in its first batch until release is closed or its context
+// is cancelled, and records the batches it processes.
+type slowNode struct {
+	name      string
+	started   chan struct{}
+	release   chan struct{}
+	batches   *int
+	cancelled *bool
+}
+
+func (n *slowNode) Name() string { return n.name }
+
+func (n *slowNode) Process(ctx context.Context, items []interface{}) ([]interface{}, error) {
+	if *n.batches++; *n.batches == 1 {
+		close(n.started)
+		select {
+		case <-n.release:
+		case <-ctx.Done():
+			*n.cancelled = true
+			return nil, ctx.Err()
+		}
+	}
+	return items, nil
+}
+
+func TestRunPipelineGracefulCancel(t *testing.T) {
+	registerRecordingNode(make(map[string]*[]interface{}))
+	defer func(grace time.Duration) { shutdownGrace = grace }(shutdownGrace)
+
+	for _, tc := range []struct {
+		name      string
+		grace     time.Duration
+		cancelled bool // the running batch sees its context cancelled
+	}{{"finishes running batch", time.Minute, false}, {"grace expires", 10 * time.Millisecond, true}} {
+		t.Run(tc.name, func(t *testing.T) {
+			shutdownGrace = tc.grace
+			started, release := make(chan struct{}), make(chan struct{})
+			var batches int
+			var cancelled bool
+			nodes.RegisterNode("slow", func(name string, config map[string]interface{}) nodes.Node {
+				return &slowNode{name: name, started: started, release: release, batches: &batches, cancelled: &cancelled}
+			})
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() {
+				done <- RunPipeline(ctx, "graceful", PipelineConfig{Nodes: []nodes.PipelineNode{
+					{Name: "Source", Type: "recording", Config: map[string]interface{}{"emit": []interface{}{1, 2, 3}}},
+					{Name: "Slow", Type: "slow", BatchSize: 1},
+				}})
+			}()
+			<-started
+			cancel()
+			if !tc.cancelled {
+				time.Sleep(20 * time.Millisecond) // the batch keeps running
+				close(release)
+			}
+			err := <-done
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("expected a cancelled run, got %v", err)
+			}
+			if batches != 1 || cancelled != tc.cancelled {
+				t.Errorf("expected 1 batch (cancelled: %v), got %d (cancelled: %v)", tc.cancelled, batches, cancelled)
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Statuses of a run and of its nodes.
+const (
+	statusPending   = "pending"
+	statusRunning   = "running"
+	statusSucceeded = "succeeded"
+	statusFailed    = "failed"
+	statusCancelled = "cancelled"
+)
+
+// maxFinishedRuns is how many finished runs a runRegistry remembers.
+const maxFinishedRuns = 100
+
+// errAlreadyRunning is returned by runRegistry.start for a pipeline that has
+// a run in progress in this process.
+var errAlreadyRunning = errors.New("pipeline is already running")
+
+// errShuttingDown is returned by runRegistry.start once shutdown was called.
+var errShuttingDown = errors.New("shutting down")
+
+// runRegistry tracks the pipeline runs started by serve mode, so they can be
+// monitored and cancelled through the HTTP API.
+type runRegistry struct {
+	mu       sync.Mutex
+	runs     map[string]*runStatus
+	active   map[string]*runStatus // by pipeline
+	finished []string              // IDs of finished runs, oldest first
+	closed   bool                  // no new runs are started
+	wg       sync.WaitGroup
+}
+
+func newRunRegistry() *runRegistry {
+	return &runRegistry{runs: make(map[string]*runStatus), active: make(map[string]*runStatus)}
+}
+
+// start runs a pipeline in the background and returns its status. The run
+// is cancelled through runStatus.cancel, not by the caller's context.
+func (g *runRegistry) start(pipelineName string, pipelineCfg PipelineConfig) (*runStatus, error) {
+	run, ctx, err := g.register(pipelineName, pipelineCfg)
+	if err != nil {
+		return nil, err
+	}
+	go g.execute(ctx, run, pipelineCfg)
+	return run, nil
+}
+
+// run runs a pipeline and returns once it has finished.
+func (g *runRegistry) run(pipelineName string, pipelineCfg PipelineConfig) (*runStatus, error) {
+	run, ctx, err := g.register(pipelineName, pipelineCfg)
+	if err != nil {
+		return nil, err
+	}
+	g.execute(ctx, run, pipelineCfg)
+	return run, nil
+}
+
+func (g *runRegistry) register(pipelineName string, pipelineCfg PipelineConfig) (*runStatus, context.Context, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return nil, nil, errShuttingDown
+	}
+	if current, ok := g.active[pipelineName]; ok {
+		return nil, nil, fmt.Errorf("%w (run %s)", errAlreadyRunning, current.ID)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &runStatus{
+		runInfo: runInfo{
+			ID:       newRunID(),
+			Pipeline: pipelineName,
+			Status:   statusRunning,
+			Started:  time.Now().UTC(),
+			Nodes:    make([]nodeProgress, len(pipelineCfg.Nodes)),
+		},
+		cancel: cancel,
+	}
+	for i, nodeCfg := range pipelineCfg.Nodes {
+		run.Nodes[i] = nodeProgress{Name: nodeCfg.Name, Status: statusPending}
+	}
+	g.runs[run.ID] = run
+	g.active[pipelineName] = run
+	g.wg.Add(1)
+	return run, ctx, nil
+}
+
+func (g *runRegistry) execute(ctx context.Context, run *runStatus, pipelineCfg PipelineConfig) {
+	defer g.wg.Done()
+	err := runPipeline(ctx, run.Pipeline, pipelineCfg, runOptions{runID: run.ID, progress: run})
+	run.finish(err, ctx.Err() != nil)
+	run.cancel()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.active, run.Pipeline)
+	g.finished = append(g.finished, run.ID)
+	for len(g.finished) > maxFinishedRuns {
+		delete(g.runs, g.finished[0])
+		g.finished = g.finished[1:]
+	}
+}
+
+// get returns the run with the given ID.
+func (g *runRegistry) get(id string) (*runStatus, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	run, ok := g.runs[id]
+	return run, ok
+}
+
+// running returns the run of a pipeline in progress, if any.
+func (g *runRegistry) running(pipelineName string) (*runStatus, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	run, ok := g.active[pipelineName]
+	return run, ok
+}
+
+// shutdown stops starting runs and cancels the active ones.
+func (g *runRegistry) shutdown() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.closed = true
+	for _, run := range g.active {
+		run.cancel()
+	}
+}
+
+// wait blocks until all runs have finished.
+func (g *runRegistry) wait() {
+	g.wg.Wait()
+}
+
+// runInfo is the status and per-node progress of a run, as returned by the
+// HTTP API.
+type runInfo struct {
+	ID       string         `json:"id"`
+	Pipeline string         `json:"pipeline"`
+	Status   string         `json:"status"`
+	Started  time.Time      `json:"started"`
+	Finished *time.Time     `json:"finished,omitempty"`
+	Error    string         `json:"error,omitempty"`
+	Nodes    []nodeProgress `json:"nodes"`
+}
+
+// runStatus tracks a run while it progresses. The fields of runInfo are
+// guarded by mu; use snapshot to read them.
+type runStatus struct {
+	mu sync.Mutex
+	runInfo
+	cancel context.CancelFunc
+}
+
+// nodeProgress is the progress of one node. In streaming runs the counts
+// add up over all micro-batches.
+type nodeProgress struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Batches    int    `json:"batches"`
+	ItemsIn    int    `json:"itemsIn"`
+	ItemsOut   int    `json:"itemsOut"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// snapshot returns a copy of the status that is safe to encode.
+func (s *runStatus) snapshot() runInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info := s.runInfo
+	info.Nodes = append([]nodeProgress(nil), s.Nodes...)
+	return info
+}
+
+// nodeStarted records that node i started processing n items. It is a
+// no-op on a nil status, so runs without progress tracking need no checks.
+func (s *runStatus) nodeStarted(i, n int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Nodes[i].Status = statusRunning
+	s.Nodes[i].ItemsIn += n
+}
+
+// nodeFinished records the outcome of a node's batch.
+func (s *runStatus) nodeFinished(i, n int, d time.Duration, err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	node := &s.Nodes[i]
+	node.Batches++
+	node.ItemsOut += n
+	node.DurationMs += d.Milliseconds()
+	node.Status = statusSucceeded
+	if err != nil {
+		node.Status = statusFailed
+	}
+}
+
+// finish records the outcome of the run.
+func (s *runStatus) finish(err error, cancelled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	s.Finished = &now
+	switch {
+	case cancelled:
+		s.Status = statusCancelled
+	case err != nil:
+		s.Status = statusFailed
+	default:
+		s.Status = statusSucceeded
+	}
+	if err != nil {
+		s.Error = err.Error()
+	}
+}
+
+// sourceEmitted records a micro-batch emitted by a streaming source.
+func (s *runStatus) sourceEmitted(n int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Nodes[0].Batches++
+	s.Nodes[0].ItemsOut += n
+}
+
+// sourceEnded records that a streaming source has stopped.
+func (s *runStatus) sourceEnded(d time.Duration, err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Nodes[0].DurationMs = d.Milliseconds()
+	s.Nodes[0].Status = statusSucceeded
+	if err != nil {
+		s.Nodes[0].Status = statusFailed
+	}
+}
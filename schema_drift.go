@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"data-pipeline/helpers"
+)
+
+// Schema drift policies.
+const (
+	driftIgnore = "ignore"
+	driftWarn   = "warn"
+	driftFail   = "fail"
+)
+
+// schemaTracker infers the schema of node outputs during a run, compares it
+// with the schema stored by the last successful run and applies the drift
+// policies. Schemas are stored per run as <storeDir>/<pipeline>/<runId>.json,
+// of which the newest keepRuns are kept; latest.json holds the schema of the
+// last successful run.
+//
+// In streaming runs a node's output arrives in micro-batches. Its schema is
+// accumulated over the whole run; fields that appear or change type are
+// reported as soon as a micro-batch shows them, while fields that disappeared
+// or lost a type can only be told once the stream has ended (see finish).
+type schemaTracker struct {
+	cfg       SchemaDriftConfig
+	dir       string
+	runID     string
+	streaming bool
+	previous  map[string]*helpers.Schema        // by node name, from the last successful run
+	current   map[string]*helpers.SchemaBuilder // by node name, this run
+	reported  map[string]bool                   // "<node>/<kind>/<field>" of changes already reported
+}
+
+// newSchemaTracker loads the previous schema for pipelineName. It returns nil
+// if drift detection is disabled.
+func newSchemaTracker(cfg SchemaDriftConfig, pipelineName, runID string) (*schemaTracker, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	t := &schemaTracker{
+		cfg:      cfg,
+		dir:      filepath.Join(cfg.StoreDir, pipelineName),
+		runID:    runID,
+		previous: make(map[string]*helpers.Schema),
+		current:  make(map[string]*helpers.SchemaBuilder),
+		reported: make(map[string]bool),
+	}
+	data, err := os.ReadFile(filepath.Join(t.dir, "latest.json"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read previous schema: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &t.previous); err != nil {
+			return nil, fmt.Errorf("failed to parse previous schema: %w", err)
+		}
+	}
+	return t, nil
+}
+
+// tracks reports whether the output of nodeName is tracked.
+func (t *schemaTracker) tracks(nodeName string) bool {
+	if len(t.cfg.Nodes) == 0 {
+		return true
+	}
+	for _, n := range t.cfg.Nodes {
+		if n == nodeName {
+			return true
+		}
+	}
+	return false
+}
+
+// observe adds a node's output to the schema inferred for it in this run
+// and checks that against the previous run. It returns an error if a change
+// violates a "fail" policy.
+func (t *schemaTracker) observe(nodeName string, items []interface{}, logPrefix string) error {
+	if !t.tracks(nodeName) {
+		return nil
+	}
+	builder, ok := t.current[nodeName]
+	if !ok {
+		builder = helpers.NewSchemaBuilder()
+		t.current[nodeName] = builder
+	}
+	builder.Add(items...)
+	return t.check(nodeName, !t.streaming, logPrefix)
+}
+
+// finish checks the schemas accumulated by a streaming run once the stream
+// has ended, which is when fields that disappeared can be told.
+func (t *schemaTracker) finish(logPrefix string) error {
+	if !t.streaming {
+		return nil
+	}
+	names := make([]string, 0, len(t.current))
+	for name := range t.current {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := t.check(name, true, logPrefix); err != nil {
+			return fmt.Errorf("node '%s': %w", name, err)
+		}
+	}
+	return nil
+}
+
+// check compares the schema accumulated for a node with the previous run and
+// reports changes not reported yet. Unless complete, the node's output may
+// still grow, so only fields that appeared or gained a type are reported.
+func (t *schemaTracker) check(nodeName string, complete bool, logPrefix string) error {
+	previous, ok := t.previous[nodeName]
+	schema := t.current[nodeName].Schema()
+	if !ok || previous.Records == 0 || schema.Records == 0 {
+		// Nothing to compare against; an empty output says nothing about fields.
+		return nil
+	}
+
+	var failures []string
+	for _, change := range helpers.CompareSchemas(previous, schema) {
+		if !complete && (change.Kind == "removed" || change.Kind == "typeChanged" && !gainedType(change)) {
+			continue
+		}
+		key := nodeName + "/" + change.Kind + "/" + change.Field
+		if t.reported[key] {
+			continue
+		}
+		t.reported[key] = true
+		policy := t.policy(change.Kind)
+		switch policy {
+		case driftWarn:
+			log.Printf("%s Warning: schema drift: %s", logPrefix, change)
+		case driftFail:
+			log.Printf("%s ERROR: schema drift: %s", logPrefix, change)
+			failures = append(failures, change.String())
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("schema drift: %s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// gainedType reports whether a type change adds a type the field did not
+// have before.
+func gainedType(change helpers.SchemaChange) bool {
+	for _, typ := range change.To {
+		if !slices.Contains(change.From, typ) {
+			return true
+		}
+	}
+	return false
+}
+
+// policy returns the configured policy for a change kind.
+func (t *schemaTracker) policy(kind string) string {
+	switch kind {
+	case "added":
+		return t.cfg.OnFieldAdded
+	case "removed":
+		return t.cfg.OnFieldRemoved
+	}
+	return t.cfg.OnTypeChanged
+}
+
+// save stores the schema observed in this run. Only successful runs become
+// the baseline for the next comparison. Nodes that did not run or produced no
+// records keep their previous schema in the baseline.
+func (t *schemaTracker) save(success bool) error {
+	if err := os.MkdirAll(t.dir, 0755); err != nil {
+		return err
+	}
+	current := make(map[string]*helpers.Schema, len(t.current))
+	for name, builder := range t.current {
+		current[name] = builder.Schema()
+	}
+	if err := writeJSONFile(filepath.Join(t.dir, t.runID+".json"), current); err != nil {
+		return err
+	}
+	if err := t.prune(); err != nil {
+		log.Printf("Warning: failed to remove old schema files in %s: %v", t.dir, err)
+	}
+	if !success {
+		return nil
+	}
+	baseline := make(map[string]*helpers.Schema, len(t.previous)+len(current))
+	for name, s := range t.previous {
+		baseline[name] = s
+	}
+	for name, s := range current {
+		if s.Records > 0 {
+			baseline[name] = s
+		}
+	}
+	return writeJSONFile(filepath.Join(t.dir, "latest.json"), baseline)
+}
+
+// prune removes all but the newest keepRuns per-run schema files.
+func (t *schemaTracker) prune() error {
+	entries, err := os.ReadDir(t.dir)
+	if err != nil {
+		return err
+	}
+	type runFile struct {
+		name    string
+		modTime time.Time
+	}
+	var runs []runFile
+	for _, e := range entries {
+		if e.IsDir() || e.Name() == "latest.json" || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		runs = append(runs, runFile{e.Name(), info.ModTime()})
+	}
+	if len(runs) <= t.cfg.KeepRuns {
+		return nil
+	}
+	// Newest first; run IDs start with their time, so names break ties.
+	sort.Slice(runs, func(i, j int) bool {
+		if !runs[i].modTime.Equal(runs[j].modTime) {
+			return runs[i].modTime.After(runs[j].modTime)
+		}
+		return runs[i].name > runs[j].name
+	})
+	var errs []error
+	for _, r := range runs[t.cfg.KeepRuns:] {
+		if err := os.Remove(filepath.Join(t.dir, r.name)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// writeJSONFile writes v as indented JSON to path. The file is replaced
+// atomically, so a crash never leaves a torn latest.json behind.
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return helpers.WriteFileAtomic(path, data, 0644)
+}
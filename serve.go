@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/robfig/cron/v3"
+)
+
+const serveUsage = `Usage: data-pipeline serve [--config FILE] [--listen ADDR] [--token TOKEN]
+
+Keeps running and triggers every pipeline that has a schedule (see the
+pipeline's schedule setting in config.yaml). With --listen (e.g. :8080) it
+also serves an HTTP API to start, monitor and cancel runs:
+
+  GET    /pipelines              list pipelines
+  POST   /pipelines/{name}/runs  start a run, optionally with node config
+                                 overrides: {"overrides": {"Node": {"key": 1}}}
+  GET    /runs/{id}              status, per-node progress and item counts
+  DELETE /runs/{id}              cancel a run
+
+Requests must send "Authorization: Bearer TOKEN" when a token is set with
+--token or the DATA_PIPELINE_API_TOKEN environment variable. A token is
+required unless the API listens on a loopback address (e.g. 127.0.0.1:8080).
+Overrides may not change connections, credentials, queries or file paths,
+at any depth, nor follow, groupId or mode.
+
+On SIGINT or SIGTERM no new runs are started and the runs in flight are
+cancelled: they start no new batches, and running batches get the shutdown
+grace period (shutdown.grace in config.yaml) to finish. A second signal
+aborts them at once.
+`
+
+// serveCommand runs `data-pipeline serve` and returns the exit code.
+func serveCommand(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(fs.Output(), serveUsage) }
+	configFile := fs.String("config", "config.yaml", "Path to the configuration file")
+	listen := fs.String("listen", "", "Address of the HTTP API, e.g. :8080 (disabled if empty)")
+	token := fs.String("token", os.Getenv("DATA_PIPELINE_API_TOKEN"), "Bearer token required by the HTTP API")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err == nil {
+		err = applySettings(cfg)
+	}
+	runs := newRunRegistry()
+	var s *scheduler
+	if err == nil {
+		s, err = newScheduler(cfg, runs)
+	}
+	if err == nil && len(s.pipelines) == 0 && *listen == "" {
+		err = errors.New("no pipeline has a schedule and --listen is not set")
+	}
+	var api *http.Server
+	if err == nil && *listen != "" {
+		api = &http.Server{Addr: *listen, Handler: (&apiServer{cfg: cfg, runs: runs, token: *token}).handler()}
+		var ln net.Listener
+		if ln, err = net.Listen("tcp", *listen); err == nil && *token == "" && !isLoopback(ln.Addr()) {
+			ln.Close()
+			err = fmt.Errorf("the HTTP API on %s needs --token (or DATA_PIPELINE_API_TOKEN) unless it listens on a loopback address", ln.Addr())
+		}
+		if err == nil {
+			log.Printf("HTTP API listening on %s.", ln.Addr())
+			go func() {
+				if err := api.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					log.Printf("ERROR: HTTP API stopped: %v", err)
+				}
+			}()
+		}
+	}
+	if err == nil {
+		ctx, stop := interruptContext()
+		s.start()
+		<-ctx.Done()
+		runs.shutdown()
+		if api != nil {
+			api.Shutdown(context.Background())
+		}
+		s.stop()
+		runs.wait()
+		stop()
+	}
+	if closeErr := releaseSettings(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "serve: %v\n", err)
+		return 1
+	}
+	log.Println("Scheduler stopped.")
+	return 0
+}
+
+// isLoopback reports whether addr only accepts connections from this host.
+func isLoopback(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	return ok && tcp.IP.IsLoopback()
+}
+
+// scheduler triggers the scheduled pipelines of a configuration.
+type scheduler struct {
+	cron      *cron.Cron
+	pipelines []*scheduledPipeline
+}
+
+// newScheduler registers every pipeline of cfg that has a schedule. Runs go
+// through runs, so they show up in the HTTP API and never overlap with runs
+// started there.
+func newScheduler(cfg *AppConfig, runs *runRegistry) (*scheduler, error) {
+	s := &scheduler{cron: cron.New()}
+	names := make([]string, 0, len(cfg.Pipelines))
+	for name := range cfg.Pipelines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pipelineCfg := cfg.Pipelines[name]
+		if pipelineCfg.Schedule.Cron == "" {
+			continue
+		}
+		p := &scheduledPipeline{name: name, cfg: pipelineCfg, runs: runs}
+		id, err := s.cron.AddFunc(pipelineCfg.Schedule.spec(), p.trigger)
+		if err != nil {
+			return nil, fmt.Errorf("pipeline %s: invalid schedule: %w", name, err)
+		}
+		p.entry = id
+		s.pipelines = append(s.pipelines, p)
+	}
+	return s, nil
+}
+
+// start begins triggering pipelines.
+func (s *scheduler) start() {
+	s.cron.Start()
+	for _, p := range s.pipelines {
+		log.Printf("[%s] Scheduled %q (overlap: %s); next run at %s.",
+			p.name, p.cfg.Schedule.spec(), p.cfg.Schedule.Overlap, s.cron.Entry(p.entry).Next.Format("2006-01-02 15:04:05 MST"))
+	}
+}
+
+// stop stops triggering pipelines, drops queued runs and waits for the
+// triggered runs to finish.
+func (s *scheduler) stop() {
+	for _, p := range s.pipelines {
+		p.mu.Lock()
+		p.stopped = true
+		p.mu.Unlock()
+	}
+	<-s.cron.Stop().Done()
+}
+
+// scheduledPipeline runs one pipeline when its schedule fires and applies
+// its overlap policy.
+type scheduledPipeline struct {
+	name  string
+	cfg   PipelineConfig
+	runs  *runRegistry
+	entry cron.EntryID
+
+	mu      sync.Mutex
+	running bool // a run is in progress
+	queued  bool // another run starts when it ends (overlap "queue")
+	stopped bool // the scheduler is shutting down
+}
+
+// trigger runs the pipeline unless it is running already, in which case
+// the trigger is skipped or queued. It returns when the pipeline and any run
+// queued meanwhile have finished.
+func (p *scheduledPipeline) trigger() {
+	p.mu.Lock()
+	if p.running {
+		if p.cfg.Schedule.Overlap == overlapQueue && !p.queued {
+			p.queued = true
+			log.Printf("[%s] Previous run still in progress; queued the next one.", p.name)
+		} else {
+			log.Printf("[%s] Previous run still in progress; skipped this one.", p.name)
+		}
+		p.mu.Unlock()
+		return
+	}
+	p.running = true
+	p.mu.Unlock()
+
+	for {
+		log.Printf("--- Running scheduled pipeline: %s ---", p.name)
+		if run, err := p.runs.run(p.name, p.cfg); err != nil {
+			log.Printf("[%s] Skipped scheduled run: %v", p.name, err)
+		} else if status := run.snapshot(); status.Error != "" {
+			log.Printf("ERROR: Pipeline '%s' failed: %s", p.name, status.Error)
+		} else {
+			log.Printf("--- Pipeline '%s' completed successfully ---", p.name)
+		}
+
+		p.mu.Lock()
+		if !p.queued || p.stopped {
+			p.running, p.queued = false, false
+			p.mu.Unlock()
+			return
+		}
+		p.queued = false
+		p.mu.Unlock()
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"data-pipeline/helpers"
+	"data-pipeline/nodes"
+)
+
+const stateUsage = `Usage: data-pipeline state <command> [flags] [args]
+
+Inspects and edits the state nodes keep between runs (watermarks, offsets,
+file positions, seen keys) in the configured state backend.
+
+Commands:
+  list  --pipeline P [--node N]           print the state of a pipeline's nodes
+  get   --pipeline P --node N KEY         print one value
+  set   --pipeline P --node N KEY VALUE   store a value
+  set   --pipeline P --node N --from DATE move a time-based watermark to DATE
+                                          (2025-01-01 or RFC 3339)
+  reset --pipeline P --node N [KEY]       delete the node's state, or one key
+
+Flags:
+  --config FILE   configuration file (default config.yaml)
+
+Flags come before KEY and VALUE. list and get read a snapshot of the state
+and work while the pipeline is running; set and reset take the pipeline's
+run lock, so they fail while it is running.
+`
+
+// stateOptions are the parsed flags and arguments of a state command.
+type stateOptions struct {
+	pipeline string
+	node     string
+	from     string
+	args     []string
+}
+
+// stateCommand runs `data-pipeline state ...` and returns the exit code.
+func stateCommand(args []string, out io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprint(os.Stderr, stateUsage)
+		return 2
+	}
+	cmd := args[0]
+	fs := flag.NewFlagSet("state "+cmd, flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(fs.Output(), stateUsage) }
+	configFile := fs.String("config", "config.yaml", "Path to the configuration file")
+	var opts stateOptions
+	fs.StringVar(&opts.pipeline, "pipeline", "", "Pipeline name")
+	fs.StringVar(&opts.node, "node", "", "Node name")
+	fs.StringVar(&opts.from, "from", "", "Date to move a time-based watermark to")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	opts.args = fs.Args()
+
+	cfg, err := loadConfig(*configFile)
+	if err == nil {
+		err = applySettings(cfg)
+	}
+	if err == nil {
+		err = runStateCommand(cfg, cmd, opts, out)
+	}
+	if closeErr := releaseSettings(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "state %s: %v\n", cmd, err)
+		return 1
+	}
+	return 0
+}
+
+// runStateCommand runs one state command against the pipelines of cfg.
+func runStateCommand(cfg *AppConfig, cmd string, opts stateOptions, out io.Writer) error {
+	pipelineCfg, ok := cfg.Pipelines[opts.pipeline]
+	if !ok {
+		return fmt.Errorf("unknown pipeline '%s'", opts.pipeline)
+	}
+	switch cmd {
+	case "list":
+		return listState(pipelineCfg, opts, out)
+	case "get", "set", "reset":
+	default:
+		return fmt.Errorf("unknown command %q (want list, get, set or reset)", cmd)
+	}
+	if opts.node == "" {
+		return errors.New("--node is required")
+	}
+
+	if cmd != "get" {
+		// Edits must not interleave with a run of the pipeline.
+		lock, err := lockPipeline(opts.pipeline)
+		if err != nil {
+			return err
+		}
+		defer lock.Release()
+	}
+	node, store, err := openNodeState(pipelineCfg, opts.pipeline, opts.node, cmd == "get")
+	if err != nil {
+		return err
+	}
+	defer closeNodes(opts.pipeline, []nodes.Node{node})
+
+	switch {
+	case cmd == "get" && len(opts.args) == 1:
+		value, ok, err := store.Get(opts.args[0])
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("node '%s' has no key %q", opts.node, opts.args[0])
+		}
+		fmt.Fprintln(out, value)
+		return nil
+
+	case cmd == "set" && opts.from != "" && len(opts.args) == 0:
+		from, err := parseDateFlag("from", opts.from)
+		if err != nil {
+			return err
+		}
+		watermarked, ok := node.(nodes.TimeWatermarked)
+		if !ok {
+			return fmt.Errorf("node '%s' has no time-based watermark; set a key instead", opts.node)
+		}
+		key, value, err := watermarked.TimeWatermark(from)
+		if err != nil {
+			return fmt.Errorf("node '%s': %w", opts.node, err)
+		}
+		return setState(store, opts.node, key, value, out)
+
+	case cmd == "set" && opts.from == "" && len(opts.args) == 2:
+		return setState(store, opts.node, opts.args[0], opts.args[1], out)
+
+	case cmd == "reset" && len(opts.args) == 1:
+		if err := store.Delete(opts.args[0]); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s: deleted %s\n", opts.node, opts.args[0])
+		return nil
+
+	case cmd == "reset" && len(opts.args) == 0:
+		entries, err := store.List("")
+		if err != nil {
+			return err
+		}
+		keys := make([]string, 0, len(entries))
+		for key := range entries {
+			keys = append(keys, key)
+		}
+		if err := helpers.ApplyState(store, nil, keys); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s: deleted %d key(s)\n", opts.node, len(keys))
+		return nil
+	}
+	return fmt.Errorf("wrong arguments for %s\n\n%s", cmd, stateUsage)
+}
+
+// listState prints the state of one or all stateful nodes of a pipeline.
+func listState(pipelineCfg PipelineConfig, opts stateOptions, out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tKEY\tVALUE")
+	found := false
+	for _, nodeCfg := range pipelineCfg.Nodes {
+		if opts.node != "" && nodeCfg.Name != opts.node {
+			continue
+		}
+		found = true
+		node, store, err := openNodeState(pipelineCfg, opts.pipeline, nodeCfg.Name, true)
+		if err != nil {
+			if opts.node == "" && errors.Is(err, errStateless) {
+				continue
+			}
+			return err
+		}
+		entries, err := store.List("")
+		closeNodes(opts.pipeline, []nodes.Node{node})
+		if err != nil {
+			return fmt.Errorf("node '%s': %w", nodeCfg.Name, err)
+		}
+		keys := make([]string, 0, len(entries))
+		for key := range entries {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", nodeCfg.Name, key, entries[key])
+		}
+	}
+	if !found {
+		return fmt.Errorf("pipeline '%s' has no node '%s'", opts.pipeline, opts.node)
+	}
+	return w.Flush()
+}
+
+// errStateless is returned by openNodeState for nodes that keep no state.
+var errStateless = errors.New("keeps no state")
+
+// openNodeState instantiates a node of a pipeline and opens its state, in
+// the shared state store or the node's own file. With readOnly the state is
+// a snapshot that takes no file locks (see stateSnapshot).
+func openNodeState(pipelineCfg PipelineConfig, pipelineName, nodeName string, readOnly bool) (nodes.Node, helpers.StateStore, error) {
+	i := slices.IndexFunc(pipelineCfg.Nodes, func(n nodes.PipelineNode) bool { return n.Name == nodeName })
+	if i < 0 {
+		return nil, nil, fmt.Errorf("pipeline '%s' has no node '%s'", pipelineName, nodeName)
+	}
+	node, err := nodes.GetNodeInstance(pipelineCfg.Nodes[i])
+	if err != nil {
+		return nil, nil, fmt.Errorf("node '%s': %w", nodeName, err)
+	}
+	aware, ok := node.(nodes.StateAware)
+	if !ok {
+		return nil, nil, fmt.Errorf("node '%s' %w", nodeName, errStateless)
+	}
+	var store helpers.StateStore
+	if readOnly {
+		store, err = stateSnapshot(aware, pipelineName, nodeName)
+	} else {
+		store, err = nodeStateStore(aware, pipelineName, nodeName)
+	}
+	if err != nil {
+		closeNodes(pipelineName, []nodes.Node{node})
+		return nil, nil, fmt.Errorf("node '%s': %w", nodeName, err)
+	}
+	return node, store, nil
+}
+
+func setState(store helpers.StateStore, nodeName, key, value string, out io.Writer) error {
+	if err := store.Set(key, value); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s: %s = %s\n", nodeName, key, value)
+	return nil
+}
+
+// parseDateFlag parses a date flag such as --from: a date or an RFC 3339
+// timestamp. flagName is used in the error.
+func parseDateFlag(flagName, s string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --%s %q (want 2025-01-01 or RFC 3339)", flagName, s)
+	}
+	return t, nil
+}